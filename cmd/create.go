@@ -34,7 +34,31 @@ import (
 var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Creates empty database for gnames",
+	Long: `Creates empty database for gnames.
+
+With --staging flag the database is created in a separate staging schema,
+while the public schema stays intact. Use the same flag with rebuild, and
+then run 'gnidump swap' to make the staging schema public.
+
+Existing tables of the schema are destroyed. The command shows the host,
+the database and its tables and asks to type the database name to continue.
+Runs without a terminal require --force flag. With --backup flag existing
+tables are saved to compressed COPY files in InputDir before the reset.
+The verification view is not saved. After the tables are restored, run
+'gnidump rebuild --steps verification' to recreate it.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		staging, _ := cmd.Flags().GetBool("staging")
+		if staging {
+			opts = append(opts, config.OptStaging(true))
+		}
+		force, _ := cmd.Flags().GetBool("force")
+		if force {
+			opts = append(opts, config.OptForce(true))
+		}
+		backup, _ := cmd.Flags().GetBool("backup")
+		if backup {
+			opts = append(opts, config.OptBackup(true))
+		}
 		cfg := config.New(opts...)
 		err := buildio.Create(cfg)
 		if err != nil {
@@ -47,6 +71,13 @@ var createCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(createCmd)
 
+	createCmd.Flags().Bool("staging", false,
+		"create database in the staging schema")
+	createCmd.Flags().Bool("force", false,
+		"reset existing database without confirmation")
+	createCmd.Flags().Bool("backup", false,
+		"save existing tables to InputDir before the reset")
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -23,6 +23,7 @@ package cmd
 import (
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/gnames/gnidump/internal/io/dumpio"
 	gnidump "github.com/gnames/gnidump/pkg"
@@ -34,7 +35,61 @@ import (
 var dumpCmd = &cobra.Command{
 	Use:   "dump",
 	Short: "Dumps GNI data to CSV files.",
-	Run: func(_ *cobra.Command, _ []string) {
+	Long: `Dumps GNI data to CSV files.
+
+By default the dump only reads GNI database. With --sync-dates flag it also
+saves the date of the latest harvest of each data-source to
+data_sources.updated_at of GNI database.
+
+All tables are read from one consistent snapshot of GNI database. By
+default the snapshot is read with one connection. With --lock-tables flag
+large tables are read in parallel by JobsNum connections. To give them the
+same snapshot, the dump runs FLUSH TABLES WITH READ LOCK while their
+transactions start. It blocks all writers of GNI database for that moment
+and requires RELOAD privilege.
+
+The progress of the dump is saved in the dump directory. If the dump fails,
+run it with --resume flag to continue from the last finished chunk. The
+resumed dump reads the rest of the data from a new snapshot, so files of
+the dump would not agree with each other if GNI database changed between
+the runs. Such dump requires --mixed-snapshots flag, and the builder warns
+about it during import.
+
+With --since or --sources flags the dump is incremental. It contains
+indices and vernacular indices of data-sources harvested since the given
+date or listed by their IDs, together with name-strings and vernacular
+strings they use. The data_sources table is always dumped completely.`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		syncDates, _ := cmd.Flags().GetBool("sync-dates")
+		if syncDates {
+			opts = append(opts, config.OptSyncDates(true))
+		}
+		lockTables, _ := cmd.Flags().GetBool("lock-tables")
+		if lockTables {
+			opts = append(opts, config.OptDumpLockTables(true))
+		}
+		resume, _ := cmd.Flags().GetBool("resume")
+		if resume {
+			opts = append(opts, config.OptDumpResume(true))
+		}
+		mixed, _ := cmd.Flags().GetBool("mixed-snapshots")
+		if mixed {
+			opts = append(opts, config.OptDumpMixedSnapshots(true))
+		}
+		since, _ := cmd.Flags().GetString("since")
+		if since != "" {
+			t, err := time.Parse(time.DateOnly, since)
+			if err != nil {
+				slog.Error("Cannot parse --since date, use YYYY-MM-DD format",
+					"error", err)
+				os.Exit(1)
+			}
+			opts = append(opts, config.OptDumpSince(t))
+		}
+		sources, _ := cmd.Flags().GetIntSlice("sources")
+		if len(sources) > 0 {
+			opts = append(opts, config.OptDumpSources(sources))
+		}
 		cfg := config.New(opts...)
 		gnd := gnidump.New(cfg)
 		d, err := dumpio.New(cfg)
@@ -53,4 +108,17 @@ var dumpCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(dumpCmd)
+
+	dumpCmd.Flags().Bool("sync-dates", false,
+		"update data_sources dates in GNI database before the dump")
+	dumpCmd.Flags().Bool("lock-tables", false,
+		"lock GNI database briefly to read large tables in parallel")
+	dumpCmd.Flags().BoolP("resume", "r", false,
+		"continue the previous unfinished dump")
+	dumpCmd.Flags().Bool("mixed-snapshots", false,
+		"allow resumed dump to combine data from different snapshots")
+	dumpCmd.Flags().String("since", "",
+		"dump only data-sources harvested since the date (YYYY-MM-DD)")
+	dumpCmd.Flags().IntSlice("sources", nil,
+		"dump only data-sources with the given IDs, e.g. 1,3,11")
 }
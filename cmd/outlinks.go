@@ -0,0 +1,125 @@
+/*
+Copyright © 2025 Dmitry Mozzherin <dmozzherin@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/gnames/gnidump/internal/io/buildio"
+	gnidump "github.com/gnames/gnidump/pkg"
+	"github.com/gnames/gnidump/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// outlinksCmd represents the outlinks command
+var outlinksCmd = &cobra.Command{
+	Use:   "outlinks",
+	Short: "Recomputes outlinks of data-sources in the database",
+	Long: `Recomputes outlinks of data-sources in the database.
+
+Name IDs and outlink IDs of name-string indices are created again from
+stored record IDs, local IDs, global IDs and canonical forms, using nameID
+and outlinkID rules of the data-sources registry. Outlink URLs and outlink
+readiness of data-sources are updated from the registry as well. Use it
+after a change of outlink rules instead of a full rebuild.
+
+Without --sources flag all data-sources of the database are updated. The
+number of changed rows is reported for every data-source. If any row
+changed, the verification view is refreshed, so its clients see new
+outlinks. The whole view is refreshed, which takes some time.
+
+Use 'gnidump outlinks check' to validate outlinks of the database.
+
+Example:
+  gnidump outlinks --sources 9,207`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		sources, _ := cmd.Flags().GetIntSlice("sources")
+		if len(sources) > 0 {
+			opts = append(opts, config.OptSources(sources))
+		}
+		cfg := config.New(opts...)
+		gnd := gnidump.New(cfg)
+		b, err := buildio.New(cfg, nil, nil)
+		if err != nil {
+			slog.Error("Cannot create Builder.", "error", err)
+			os.Exit(1)
+		}
+		err = gnd.UpdateOutlinks(b)
+		if err != nil {
+			slog.Error("Cannot update outlinks", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// outlinksCheckCmd represents the outlinks check command
+var outlinksCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Checks that outlinks of data-sources are well-formed",
+	Long: `Checks that outlinks of data-sources are well-formed.
+
+For every data-source a sample of records is taken from the database and
+their outlinks are rendered from the OutlinkURL template. The check flags
+templates without '{}' placeholder, empty outlink IDs, URLs with characters
+that must be escaped, and records with more than one outlink. URLs are not
+requested, the check works offline.
+
+Without --sources flag data-sources marked as outlink-ready are checked.
+The result is printed as a table, the command fails if any data-source
+did not pass the check.
+
+Example:
+  gnidump outlinks check --sample 500`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		sources, _ := cmd.Flags().GetIntSlice("sources")
+		if len(sources) > 0 {
+			opts = append(opts, config.OptSources(sources))
+		}
+		sample, _ := cmd.Flags().GetInt("sample")
+		if sample > 0 {
+			opts = append(opts, config.OptOutlinkSampleSize(sample))
+		}
+		cfg := config.New(opts...)
+		gnd := gnidump.New(cfg)
+		b, err := buildio.New(cfg, nil, nil)
+		if err != nil {
+			slog.Error("Cannot create Builder.", "error", err)
+			os.Exit(1)
+		}
+		err = gnd.CheckOutlinks(b)
+		if err != nil {
+			slog.Error("Outlinks check failed", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(outlinksCmd)
+	outlinksCmd.AddCommand(outlinksCheckCmd)
+
+	outlinksCmd.PersistentFlags().IntSlice("sources", nil,
+		"data-sources with the given IDs")
+	outlinksCheckCmd.Flags().Int("sample", 0,
+		"number of records to check per data-source (default 100)")
+}
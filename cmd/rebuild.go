@@ -16,8 +16,12 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/gnames/gnidump/internal/ent/kv"
 	"github.com/gnames/gnidump/internal/io/buildio"
@@ -31,17 +35,57 @@ import (
 var rebuildCmd = &cobra.Command{
 	Use:   "rebuild",
 	Short: "Uses CSV dump files to recreate GNI database for PostgreSQL",
-	Run: func(_ *cobra.Command, _ []string) {
+	Long: `Uses CSV dump files to recreate GNI database for PostgreSQL.
+
+The rebuild runs in stages:
+  ` + strings.Join(buildio.StageNames(), ", ") + `
+
+Completed stages are recorded in the database. If a rebuild fails, the next
+run skips stages that were already completed and resumes from the failed one.
+The records are cleared when the last stage is done. A run limited by
+--steps, --from or --to that stops before the last stage only clears records
+of its own stages.
+
+The indices stage sets taxonomic status of every name-string index. Bare
+names, records without accepted record ID and classification, get "N/A":
+there is no dedicated status for bare names. Other records are "Accepted",
+unless their accepted record ID points to another record, then they are
+"Synonym". Name IDs are filled for data-sources with a nameID rule in the
+registry.
+
+With --sources flag only the given data-sources are rebuilt. Their indices
+and vernacular indices are replaced, new name-strings and canonical forms
+are added, and name-strings left without indices are removed. Data of other
+data-sources stays intact. The reparse stage is skipped in this mode.
+PostgreSQL cannot refresh a part of a materialized view, so the verification
+view is still recalculated for all data-sources, which takes as long as in
+a full rebuild. The view is refreshed concurrently, so services can read it
+meanwhile, unless its records are not unique.
+
+With --staging flag the rebuild uses the staging schema created by
+'gnidump create --staging'. Services keep reading the public schema until
+'gnidump swap' replaces it with the staging one.
+
+Key-value stores of name-strings and vernacular strings are kept between
+runs. Stages that need them reuse stores made from the same dump files and
+recreate them from the dump otherwise. Use --fresh-kv flag to recreate them
+unconditionally.
+
+With --sort-join flag indices are created without key-value stores. The
+dump files of strings and their indices are sorted by legacy IDs in
+temporary files in InputDir and joined in one pass.`,
+	Run: func(cmd *cobra.Command, _ []string) {
 		var err error
 		var kvSci, kvVern kv.KeyVal
+		rebuildFlags(cmd)
 		cfg := config.New(opts...)
 		gnd := gnidump.New(cfg)
-		kvSci, err = kvio.New(cfg.SciKVDir)
+		kvSci, err = kvio.New(cfg.KVStore, cfg.SciKVDir)
 		if err != nil {
 			slog.Error("Cannot create Sci Key-Value store.", "error", err)
 			os.Exit(1)
 		}
-		kvVern, err = kvio.New(cfg.VernKVDir)
+		kvVern, err = kvio.New(cfg.KVStore, cfg.VernKVDir)
 		if err != nil {
 			slog.Error("Cannot create Vern Key-Value store.", "error", err)
 			os.Exit(1)
@@ -51,7 +95,13 @@ var rebuildCmd = &cobra.Command{
 			slog.Error("Cannot create Builder.", "error", err)
 			os.Exit(1)
 		}
-		err = gnd.Build(b)
+		// Interrupt cancels the running stage, completed stages stay in the
+		// checkpoint for the next run.
+		ctx, stop := signal.NotifyContext(
+			context.Background(), os.Interrupt, syscall.SIGTERM,
+		)
+		defer stop()
+		err = gnd.Build(ctx, b)
 		if err != nil {
 			slog.Error("Cannot populate database", "error", err)
 			os.Exit(1)
@@ -61,4 +111,55 @@ var rebuildCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(rebuildCmd)
+
+	rebuildCmd.Flags().StringSliceP("steps", "s", nil,
+		"comma-separated list of stages to run")
+	rebuildCmd.Flags().StringP("from", "f", "", "first stage to run")
+	rebuildCmd.Flags().StringP("to", "t", "", "last stage to run")
+	rebuildCmd.Flags().BoolP("restart", "r", false,
+		"ignore stages completed by a previous unfinished rebuild")
+	rebuildCmd.Flags().IntSlice("sources", nil,
+		"rebuild only data-sources with the given IDs, e.g. 9,11")
+	rebuildCmd.Flags().Bool("staging", false,
+		"rebuild database in the staging schema")
+	rebuildCmd.Flags().Bool("fresh-kv", false,
+		"recreate key-value stores even if they match the dump")
+	rebuildCmd.Flags().Bool("sort-join", false,
+		"create indices by sort-merge join instead of key-value lookups")
+}
+
+// rebuildFlags converts command line flags to config options.
+func rebuildFlags(cmd *cobra.Command) {
+	steps, _ := cmd.Flags().GetStringSlice("steps")
+	if len(steps) > 0 {
+		opts = append(opts, config.OptSteps(steps))
+	}
+	from, _ := cmd.Flags().GetString("from")
+	if from != "" {
+		opts = append(opts, config.OptFromStep(from))
+	}
+	to, _ := cmd.Flags().GetString("to")
+	if to != "" {
+		opts = append(opts, config.OptToStep(to))
+	}
+	restart, _ := cmd.Flags().GetBool("restart")
+	if restart {
+		opts = append(opts, config.OptRestart(true))
+	}
+	staging, _ := cmd.Flags().GetBool("staging")
+	if staging {
+		opts = append(opts, config.OptStaging(true))
+	}
+	sources, _ := cmd.Flags().GetIntSlice("sources")
+	if len(sources) > 0 {
+		opts = append(opts, config.OptSources(sources))
+	}
+	freshKV, _ := cmd.Flags().GetBool("fresh-kv")
+	if freshKV {
+		opts = append(opts, config.OptFreshKV(true))
+	}
+	sortJoin, _ := cmd.Flags().GetBool("sort-join")
+	if sortJoin {
+		opts = append(opts, config.OptSortJoin(true))
+	}
 }
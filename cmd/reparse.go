@@ -0,0 +1,106 @@
+/*
+Copyright © 2025 Dmitry Mozzherin <dmozzherin@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/gnames/gnidump/internal/io/buildio"
+	gnidump "github.com/gnames/gnidump/pkg"
+	"github.com/gnames/gnidump/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// reparseCmd represents the reparse command
+var reparseCmd = &cobra.Command{
+	Use:   "reparse",
+	Short: "Parses name-strings of the database again",
+	Long: `Parses name-strings of the database again.
+
+Name-strings whose canonical forms, flags or parse quality changed are
+written to a report and updated in the database. The report is saved to
+InputDir, or to a file given by --report flag. Files with ".csv" extension
+get CSV format, other files get JSON lines.
+
+With --dry-run flag the database is not changed. Use it to review results
+of a new gnparser release before they reach the database.
+
+Every name-string keeps the version of gnparser that parsed it. Reparse can
+be limited to name-strings parsed by older versions (--older-than), to
+name-strings of some data-sources (--sources), or to name-strings with
+some parse quality (--parse-quality). Filters are combined. Reparse of the
+whole database records the version of gnparser in build_metadata table.
+
+Examples:
+  gnidump reparse --older-than v1.11.0
+  gnidump reparse --sources 1,11 --parse-quality 3,4 -n`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if dryRun {
+			opts = append(opts, config.OptDryRun(true))
+		}
+		report, _ := cmd.Flags().GetString("report")
+		if report != "" {
+			opts = append(opts, config.OptReparseReport(report))
+		}
+		olderThan, _ := cmd.Flags().GetString("older-than")
+		if olderThan != "" {
+			opts = append(opts, config.OptReparseOlderThan(olderThan))
+		}
+		sources, _ := cmd.Flags().GetIntSlice("sources")
+		if len(sources) > 0 {
+			opts = append(opts, config.OptSources(sources))
+		}
+		qualities, _ := cmd.Flags().GetIntSlice("parse-quality")
+		if len(qualities) > 0 {
+			opts = append(opts, config.OptParseQualities(qualities))
+		}
+		cfg := config.New(opts...)
+		gnd := gnidump.New(cfg)
+		b, err := buildio.New(cfg, nil, nil)
+		if err != nil {
+			slog.Error("Cannot create Builder.", "error", err)
+			os.Exit(1)
+		}
+		err = gnd.Reparse(b)
+		if err != nil {
+			slog.Error("Cannot reparse names", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reparseCmd)
+
+	reparseCmd.Flags().BoolP("dry-run", "n", false,
+		"report changes without saving them to the database")
+	reparseCmd.Flags().String("report", "",
+		"path to the report file (.csv or .jsonl)")
+	reparseCmd.Flags().String("older-than", "",
+		"reparse names parsed by gnparser older than the version, e.g. v1.11.0")
+	reparseCmd.Flags().IntSlice("sources", nil,
+		"reparse names of the data-sources with the given IDs")
+	reparseCmd.Flags().IntSlice("parse-quality", nil,
+		"reparse names with the given parse quality (0-4)")
+}
@@ -42,16 +42,22 @@ var (
 )
 
 type cfgData struct {
-	InputDir string
-	MyHost   string
-	MyUser   string
-	MyPass   string
-	MyDB     string
-	PgHost   string
-	PgUser   string
-	PgPass   string
-	PgDB     string
-	JobsNum  int
+	InputDir      string
+	MyHost        string
+	MyUser        string
+	MyPass        string
+	MyDB          string
+	PgHost        string
+	PgUser        string
+	PgPass        string
+	PgDB          string
+	JobsNum       int
+	Compression   string
+	DumpChunkSize int
+	KVStore       string
+	SortJoin      bool
+	SortChunkSize int
+	Pipelines     config.Pipelines
 }
 
 // rootCmd represents the base command when called without any subcommands
@@ -167,6 +173,22 @@ func getOpts() []config.Option {
 	if cfg.PgDB != "" {
 		opts = append(opts, config.OptPgDB(cfg.PgDB))
 	}
+	if cfg.Compression != "" {
+		opts = append(opts, config.OptCompression(cfg.Compression))
+	}
+	if cfg.DumpChunkSize != 0 {
+		opts = append(opts, config.OptDumpChunkSize(cfg.DumpChunkSize))
+	}
+	if cfg.KVStore != "" {
+		opts = append(opts, config.OptKVStore(cfg.KVStore))
+	}
+	if cfg.SortJoin {
+		opts = append(opts, config.OptSortJoin(true))
+	}
+	if cfg.SortChunkSize != 0 {
+		opts = append(opts, config.OptSortChunkSize(cfg.SortChunkSize))
+	}
+	opts = append(opts, config.OptPipelines(cfg.Pipelines))
 	return opts
 }
 
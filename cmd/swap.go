@@ -0,0 +1,76 @@
+/*
+Copyright © 2025 Dmitry Mozzherin <dmozzherin@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/gnames/gnidump/internal/io/buildio"
+	"github.com/gnames/gnidump/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// swapCmd represents the swap command
+var swapCmd = &cobra.Command{
+	Use:   "swap",
+	Short: "Makes the staging schema public",
+	Long: `Makes the staging schema public.
+
+In one transaction the staging schema is validated: its rebuild has to be
+finished, main tables have to be populated and the verification view has to
+exist. Then the public schema is renamed to gnidump_previous and the staging
+schema becomes public. The swap fails if 'gnidump create --staging' or
+'gnidump rebuild --staging' is running.
+
+The previous schema is kept as a rollback target. Use --rollback flag to make
+it public again, or --discard flag to remove it.`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		var err error
+		cfg := config.New(opts...)
+		rollback, _ := cmd.Flags().GetBool("rollback")
+		discard, _ := cmd.Flags().GetBool("discard")
+		switch {
+		case rollback && discard:
+			slog.Error("Use either --rollback or --discard flag")
+			os.Exit(1)
+		case rollback:
+			err = buildio.Rollback(cfg)
+		case discard:
+			err = buildio.Discard(cfg)
+		default:
+			err = buildio.Swap(cfg)
+		}
+		if err != nil {
+			slog.Error("Cannot switch schemas.", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(swapCmd)
+
+	swapCmd.Flags().Bool("rollback", false,
+		"make the previous schema public again")
+	swapCmd.Flags().Bool("discard", false, "remove the previous schema")
+}
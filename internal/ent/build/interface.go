@@ -1,7 +1,21 @@
 package build
 
+import "context"
+
 // Builder is the interface that wraps the Build method.
 type Builder interface {
-	// Build builds the data from CSV to PostgreSQL.
-	Build() error
+	// Build builds the data from CSV to PostgreSQL. The build stops when
+	// the context is canceled.
+	Build(ctx context.Context) error
+
+	// Reparse parses name-strings of the database again and updates
+	// results of parsing that changed.
+	Reparse() error
+
+	// UpdateOutlinks recomputes outlink IDs of name-string indices and
+	// outlink URLs of data-sources.
+	UpdateOutlinks() error
+
+	// CheckOutlinks checks that outlinks of data-sources are well-formed.
+	CheckOutlinks() error
 }
@@ -0,0 +1,150 @@
+package datasource
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the registry file. A file with this name in the
+// InputDir overrides entries of the embedded registry.
+const FileName = "data-sources.yaml"
+
+//go:embed data-sources.yaml
+var registryYAML []byte
+
+// Info provides metadata of a data-source.
+type Info struct {
+	// ID is the ID of the data-source in the GNI database.
+	ID int `yaml:"id"`
+
+	// Title is the full title of the data-source. If not empty, it replaces
+	// the title from the GNI database.
+	Title string `yaml:"title"`
+
+	// TitleShort is a short title of the data-source.
+	TitleShort string `yaml:"titleShort"`
+
+	// Description replaces the description from the GNI database if not
+	// empty.
+	Description string `yaml:"description"`
+
+	// UUID is the identifier of the dataset.
+	UUID string `yaml:"uuid"`
+
+	// HomeURL is the URL of the dataset's home page.
+	HomeURL string `yaml:"homeURL"`
+
+	// DataURL is the URL for downloading the dataset.
+	DataURL string `yaml:"dataURL"`
+
+	// OutlinkURL is a template of links to records of the data-source, '{}'
+	// is replaced by the outlink ID of a record.
+	OutlinkURL string `yaml:"outlinkURL"`
+
+	// OutlinkID is the rule that creates IDs for OutlinkURL from records of
+	// the data-source.
+	OutlinkID *OutlinkRule `yaml:"outlinkID"`
+
+	// NameID is the rule that extracts a nomenclatural name ID from records
+	// of the data-source. It uses the same syntax as OutlinkID, but cannot
+	// use the name_id field.
+	NameID *OutlinkRule `yaml:"nameID"`
+
+	// IsOutlinkReady is true if outlinks of the data-source can be shown.
+	IsOutlinkReady bool `yaml:"isOutlinkReady"`
+
+	// IsCurated is true if the data-source is curated by humans.
+	IsCurated bool `yaml:"isCurated"`
+
+	// IsAutoCurated is true if the data-source is curated by scripts.
+	IsAutoCurated bool `yaml:"isAutoCurated"`
+
+	// HasTaxonData is true if the data-source contains taxonomic data.
+	HasTaxonData bool `yaml:"hasTaxonData"`
+
+	// Version is the version of the dataset.
+	Version string `yaml:"version"`
+
+	// RevisionDate is the date of the dataset's revision in 'YYYY-MM-DD',
+	// 'YYYY-MM' or 'YYYY' format.
+	RevisionDate string `yaml:"revisionDate"`
+
+	// DOI is the Digital Object Identifier of the dataset.
+	DOI string `yaml:"doi"`
+
+	// Citation is the recommended citation of the dataset.
+	Citation string `yaml:"citation"`
+
+	// Authors are the authors of the dataset.
+	Authors string `yaml:"authors"`
+}
+
+// Registry provides metadata of data-sources by their IDs.
+type Registry map[int]Info
+
+// Load reads the embedded registry. If dir contains a registry file,
+// its entries replace embedded entries with the same ID.
+func Load(dir string) (Registry, error) {
+	res, err := parse(registryYAML)
+	if err != nil {
+		return nil, fmt.Errorf("embedded %s: %w", FileName, err)
+	}
+	if dir == "" {
+		return res, nil
+	}
+
+	path := filepath.Join(dir, FileName)
+	bs, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	local, err := parse(bs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for k, v := range local {
+		res[k] = v
+	}
+	return res, nil
+}
+
+func parse(bs []byte) (Registry, error) {
+	var infos []Info
+	if err := yaml.Unmarshal(bs, &infos); err != nil {
+		return nil, err
+	}
+	res := make(Registry, len(infos))
+	for _, v := range infos {
+		if v.ID == 0 {
+			return nil, fmt.Errorf("data-source '%s' has no id", v.Title)
+		}
+		if _, ok := res[v.ID]; ok {
+			return nil, fmt.Errorf("duplicate data-source id %d", v.ID)
+		}
+		if v.OutlinkID != nil {
+			if err := v.OutlinkID.compile(); err != nil {
+				return nil, fmt.Errorf("data-source %d: %w", v.ID, err)
+			}
+		}
+		if v.NameID != nil {
+			if v.NameID.Field == FieldNameID {
+				return nil, fmt.Errorf(
+					"data-source %d: nameID rule cannot use '%s' field",
+					v.ID, FieldNameID,
+				)
+			}
+			if err := v.NameID.compile(); err != nil {
+				return nil, fmt.Errorf("data-source %d: %w", v.ID, err)
+			}
+		}
+		res[v.ID] = v
+	}
+	return res, nil
+}
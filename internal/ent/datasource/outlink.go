@@ -0,0 +1,187 @@
+package datasource
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Fields of a record that can be used for outlink IDs.
+const (
+	FieldRecordID         = "record_id"
+	FieldAcceptedRecordID = "accepted_record_id"
+	FieldLocalID          = "local_id"
+	FieldGlobalID         = "global_id"
+	FieldNameID           = "name_id"
+	FieldCanonical        = "canonical"
+	FieldCanonicalFull    = "canonical_full"
+)
+
+// Record provides fields associated with a name-string in a particular
+// data-source.
+type Record struct {
+	RecordID         string
+	AcceptedRecordID string
+	LocalID          string
+	GlobalID         string
+	NameID           string
+	Canonical        string
+	CanonicalFull    string
+}
+
+// OutlinkRule describes how to create an outlink ID from a record. The ID
+// replaces '{}' in OutlinkURL of the data-source.
+//
+// Example of a rule in the registry:
+//
+//	outlinkID:
+//	  field: canonical_full
+//	  transforms:
+//	    - lowercase: true
+//	    - replace: {old: " ", new: "-"}
+type OutlinkRule struct {
+	// Field is the field of a record used for the ID.
+	Field string `yaml:"field"`
+
+	// Transforms are applied to the value of the field in the given order.
+	Transforms []Transform `yaml:"transforms"`
+
+	get func(Record) string
+}
+
+// Transform changes a value for an outlink ID. Only one of its fields can
+// be set.
+type Transform struct {
+	// LastSegment keeps the part of the value after the last occurrence of
+	// the separator.
+	LastSegment string `yaml:"lastSegment"`
+
+	// Replace replaces all occurrences of a substring.
+	Replace *Replace `yaml:"replace"`
+
+	// URLEscape escapes the value for a URL path ("path") or for a URL
+	// query ("query").
+	URLEscape string `yaml:"urlEscape"`
+
+	// Regex keeps the first capture group of the regular expression, or the
+	// whole match if there are no groups. If there is no match the value
+	// becomes empty.
+	Regex string `yaml:"regex"`
+
+	// Lowercase converts the value to lower case.
+	Lowercase bool `yaml:"lowercase"`
+
+	apply func(string) string
+}
+
+// Replace describes a replacement of a substring.
+type Replace struct {
+	Old string `yaml:"old"`
+	New string `yaml:"new"`
+}
+
+// ID creates an outlink ID from a record.
+func (r *OutlinkRule) ID(rec Record) string {
+	res := r.get(rec)
+	for _, v := range r.Transforms {
+		res = v.apply(res)
+	}
+	return res
+}
+
+// compile checks the rule and prepares it for use.
+func (r *OutlinkRule) compile() error {
+	switch r.Field {
+	case FieldRecordID:
+		r.get = func(rec Record) string { return rec.RecordID }
+	case FieldAcceptedRecordID:
+		r.get = func(rec Record) string { return rec.AcceptedRecordID }
+	case FieldLocalID:
+		r.get = func(rec Record) string { return rec.LocalID }
+	case FieldGlobalID:
+		r.get = func(rec Record) string { return rec.GlobalID }
+	case FieldNameID:
+		r.get = func(rec Record) string { return rec.NameID }
+	case FieldCanonical:
+		r.get = func(rec Record) string { return rec.Canonical }
+	case FieldCanonicalFull:
+		r.get = func(rec Record) string { return rec.CanonicalFull }
+	case "":
+		return errors.New("outlink rule has no field")
+	default:
+		return fmt.Errorf("unknown outlink field '%s'", r.Field)
+	}
+
+	for i := range r.Transforms {
+		if err := r.Transforms[i].compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Transform) compile() error {
+	var num int
+	if t.LastSegment != "" {
+		num++
+		sep := t.LastSegment
+		t.apply = func(s string) string {
+			if i := strings.LastIndex(s, sep); i >= 0 {
+				return s[i+len(sep):]
+			}
+			return s
+		}
+	}
+	if t.Replace != nil {
+		num++
+		rpl := *t.Replace
+		if rpl.Old == "" {
+			return errors.New("replace transform has empty 'old' value")
+		}
+		t.apply = func(s string) string {
+			return strings.ReplaceAll(s, rpl.Old, rpl.New)
+		}
+	}
+	if t.URLEscape != "" {
+		num++
+		switch t.URLEscape {
+		case "path":
+			t.apply = url.PathEscape
+		case "query":
+			t.apply = url.QueryEscape
+		default:
+			return fmt.Errorf(
+				"unknown urlEscape '%s', use 'path' or 'query'", t.URLEscape,
+			)
+		}
+	}
+	if t.Regex != "" {
+		num++
+		re, err := regexp.Compile(t.Regex)
+		if err != nil {
+			return err
+		}
+		t.apply = func(s string) string {
+			m := re.FindStringSubmatch(s)
+			switch {
+			case m == nil:
+				return ""
+			case len(m) > 1:
+				return m[1]
+			default:
+				return m[0]
+			}
+		}
+	}
+	if t.Lowercase {
+		num++
+		t.apply = strings.ToLower
+	}
+
+	if num != 1 {
+		return fmt.Errorf("outlink transform must have one operation, got %d", num)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package datasource
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTransforms(t *testing.T) {
+	tests := []struct {
+		msg   string
+		tr    Transform
+		value string
+		want  string
+	}{
+		{"lastSegment", Transform{LastSegment: ":"},
+			"urn:lsid:marinespecies.org:taxname:123", "123"},
+		{"lastSegment long separator", Transform{LastSegment: "::"},
+			"a::b:c", "b:c"},
+		{"lastSegment no separator", Transform{LastSegment: ":"},
+			"123", "123"},
+		{"replace", Transform{Replace: &Replace{Old: " ", New: "_"}},
+			"Bubo bubo L.", "Bubo_bubo_L."},
+		{"replace with empty", Transform{Replace: &Replace{Old: ".", New: ""}},
+			"Bubo bubo L.", "Bubo bubo L"},
+		{"urlEscape path", Transform{URLEscape: "path"},
+			"Bubo bubo/x?", "Bubo%20bubo%2Fx%3F"},
+		{"urlEscape query", Transform{URLEscape: "query"},
+			"Bubo bubo/x?", "Bubo+bubo%2Fx%3F"},
+		{"regex with group", Transform{Regex: `id=(\d+)`},
+			"http://example.org/?id=42&x=1", "42"},
+		{"regex without group", Transform{Regex: `\d+`},
+			"abc123def", "123"},
+		{"regex no match", Transform{Regex: `\d+`},
+			"abc", ""},
+		{"lowercase", Transform{Lowercase: true},
+			"Bubo Bubo", "bubo bubo"},
+	}
+
+	for _, v := range tests {
+		if err := v.tr.compile(); err != nil {
+			t.Fatalf("%s: %s", v.msg, err)
+		}
+		if res := v.tr.apply(v.value); res != v.want {
+			t.Errorf("%s: got '%s', want '%s'", v.msg, res, v.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		msg  string
+		yaml string
+		err  string
+	}{
+		{"no field", `
+- id: 1
+  outlinkID:
+    transforms:
+      - lowercase: true
+`, "outlink rule has no field"},
+		{"unknown field", `
+- id: 1
+  outlinkID:
+    field: taxon_id
+`, "unknown outlink field 'taxon_id'"},
+		{"several ops", `
+- id: 1
+  outlinkID:
+    field: record_id
+    transforms:
+      - lowercase: true
+        lastSegment: ":"
+`, "outlink transform must have one operation, got 2"},
+		{"no ops", `
+- id: 1
+  outlinkID:
+    field: record_id
+    transforms:
+      - lowercase: false
+`, "outlink transform must have one operation, got 0"},
+		{"empty replace", `
+- id: 1
+  outlinkID:
+    field: record_id
+    transforms:
+      - replace: {old: "", new: "-"}
+`, "replace transform has empty 'old' value"},
+		{"unknown urlEscape", `
+- id: 1
+  outlinkID:
+    field: record_id
+    transforms:
+      - urlEscape: fragment
+`, "unknown urlEscape 'fragment'"},
+		{"bad regex", `
+- id: 1
+  outlinkID:
+    field: record_id
+    transforms:
+      - regex: "("
+`, "missing closing )"},
+		{"nameID with name_id", `
+- id: 1
+  nameID:
+    field: name_id
+`, "nameID rule cannot use 'name_id' field"},
+		{"duplicate id", `
+- id: 1
+- id: 1
+`, "duplicate data-source id 1"},
+		{"no id", `
+- title: Nameless
+`, "data-source 'Nameless' has no id"},
+	}
+
+	for _, v := range tests {
+		_, err := parse([]byte(v.yaml))
+		if err == nil {
+			t.Errorf("%s: no error", v.msg)
+			continue
+		}
+		if !strings.Contains(err.Error(), v.err) {
+			t.Errorf("%s: got error '%s', want '%s'", v.msg, err, v.err)
+		}
+	}
+}
+
+// legacyOutlinkIDs are outlink functions of data-sources that existed
+// before outlink rules of the registry.
+var legacyOutlinkIDs = map[int]func(Record) string{
+	1: func(n Record) string { return n.RecordID },
+	2: func(n Record) string {
+		return strings.ReplaceAll(n.CanonicalFull, " ", "_")
+	},
+	3: func(n Record) string { return n.RecordID },
+	4: func(n Record) string { return url.PathEscape(n.Canonical) },
+	5: func(n Record) string { return n.RecordID },
+	9: func(n Record) string {
+		el := strings.Split(n.RecordID, ":")
+		return el[len(el)-1]
+	},
+	11:  func(n Record) string { return n.RecordID },
+	12:  func(n Record) string { return n.RecordID },
+	158: func(n Record) string { return n.RecordID },
+	165: func(n Record) string { return n.RecordID },
+	167: func(n Record) string { return n.RecordID },
+	168: func(n Record) string { return n.RecordID },
+	170: func(n Record) string { return url.QueryEscape(n.CanonicalFull) },
+	174: func(n Record) string { return n.LocalID },
+	175: func(n Record) string { return url.PathEscape(n.Canonical) },
+	180: func(n Record) string { return n.RecordID },
+	184: func(n Record) string { return n.AcceptedRecordID },
+	186: func(n Record) string { return url.PathEscape(n.Canonical) },
+	188: func(n Record) string { return n.RecordID },
+	193: func(n Record) string {
+		name := strings.ToLower(n.CanonicalFull)
+		name = strings.ReplaceAll(name, " ", "-")
+		name = strings.ReplaceAll(name, ".", "")
+		return name
+	},
+	194: func(n Record) string { return n.LocalID },
+	195: func(n Record) string { return n.RecordID },
+	196: func(n Record) string { return n.NameID },
+	197: func(n Record) string { return n.RecordID },
+	201: func(n Record) string { return n.LocalID },
+	203: func(n Record) string { return n.RecordID },
+	204: func(n Record) string { return n.RecordID },
+	207: func(n Record) string { return n.RecordID },
+	208: func(n Record) string { return n.LocalID },
+	209: func(n Record) string { return n.RecordID },
+}
+
+func TestEmbeddedOutlinkIDs(t *testing.T) {
+	reg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recs := []Record{
+		{
+			RecordID:         "urn:lsid:marinespecies.org:taxname:1054700",
+			AcceptedRecordID: "urn:lsid:marinespecies.org:taxname:1054701",
+			LocalID:          "1054700",
+			GlobalID:         "urn:lsid:marinespecies.org:taxname:1054700",
+			NameID:           "wfo-0000000001",
+			Canonical:        "Bubo bubo",
+			CanonicalFull:    "Bubo bubo",
+		},
+		{
+			RecordID:      "12345",
+			LocalID:       "local-12345",
+			Canonical:     "Aus bus cus",
+			CanonicalFull: "Aus bus var. cus",
+		},
+		{
+			RecordID:      "urn:lsid:x:",
+			Canonical:     "Aus/bus?",
+			CanonicalFull: "Aus × bus & cus",
+		},
+		{},
+	}
+
+	for id, legacy := range legacyOutlinkIDs {
+		rule := reg[id].OutlinkID
+		if rule == nil {
+			t.Errorf("data-source %d has no outlink rule", id)
+			continue
+		}
+		for _, rec := range recs {
+			if res, want := rule.ID(rec), legacy(rec); res != want {
+				t.Errorf("data-source %d, %+v: got '%s', want '%s'",
+					id, rec, res, want)
+			}
+		}
+	}
+
+	for id, v := range reg {
+		if _, ok := legacyOutlinkIDs[id]; !ok && v.OutlinkID != nil {
+			t.Errorf("data-source %d has an unexpected outlink rule", id)
+		}
+	}
+}
+
+func TestEmbeddedNameIDs(t *testing.T) {
+	reg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := reg[196].NameID
+	if rule == nil {
+		t.Fatal("WFO has no name ID rule")
+	}
+
+	tests := []struct {
+		recordID string
+		want     string
+	}{
+		{"wfo-0000012345", "wfo-0000012345"},
+		{"wfo-4000012345", "wfo-4000012345"},
+		{"wfo-000001234", ""},
+		{"wfo-0000012345-2023-12", ""},
+		{"wfc-0000012345", ""},
+		{"", ""},
+	}
+
+	for _, v := range tests {
+		if res := rule.ID(Record{RecordID: v.recordID}); res != v.want {
+			t.Errorf("%s: got '%s', want '%s'", v.recordID, res, v.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package dump
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Compression methods for CSV files of the dump.
+const (
+	// NoCompression keeps CSV files as plain text.
+	NoCompression = ""
+
+	// Gzip compresses CSV files with gzip.
+	Gzip = "gzip"
+
+	// Zstd compresses CSV files with Zstandard.
+	Zstd = "zstd"
+)
+
+// CompressionExt returns the file extension for a compression method.
+func CompressionExt(compression string) (string, error) {
+	switch compression {
+	case NoCompression, "none":
+		return "", nil
+	case Gzip:
+		return ".gz", nil
+	case Zstd:
+		return ".zst", nil
+	default:
+		return "", fmt.Errorf(
+			"unknown compression '%s', use %s or %s", compression, Gzip, Zstd,
+		)
+	}
+}
+
+// CompressionFromName detects the compression method from a file name.
+func CompressionFromName(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		return Gzip
+	case strings.HasSuffix(name, ".zst"):
+		return Zstd
+	default:
+		return NoCompression
+	}
+}
@@ -0,0 +1,152 @@
+package dump
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// ManifestFile is the name of the file in the dump directory that describes
+// the dump.
+const ManifestFile = "manifest.json"
+
+// SchemaVersion is the version of the layout of CSV files. It has to be
+// incremented every time columns of the dump change.
+const SchemaVersion = 1
+
+// Headers are names of CSV columns of dumped tables in the layout of
+// SchemaVersion.
+var Headers = map[string][]string{
+	"data_sources": {"id", "title", "description",
+		"logo_url", "web_site_url", "data_url",
+		"refresh_period_days", "name_strings_count",
+		"data_hash", "unique_names_count", "created_at",
+		"updated_at", "is_curated", "is_auto_curated", "record_count"},
+	"name_strings": {"id", "name"},
+	"name_string_indices": {"data_source_id",
+		"name_string_id", "url", "taxon_id", "global_id", "local_id",
+		"nomenclatural_code_id", "rank", "accepted_taxon_id",
+		"classification_path", "classification_path_ids",
+		"classification_path_ranks"},
+	"vernacular_strings": {"id", "name"},
+	"vernacular_string_indices": {"data_source_id",
+		"taxon_id", "vernacular_string_id", "language", "locality",
+		"country_code"},
+}
+
+// Manifest describes a dump and allows to check its integrity before
+// the import.
+type Manifest struct {
+	// GnidumpVersion is the version of gnidump that created the dump.
+	GnidumpVersion string `json:"gnidumpVersion"`
+
+	// SchemaVersion is the version of the layout of CSV files.
+	SchemaVersion int `json:"schemaVersion"`
+
+	// SnapshotAt is the UTC time of the consistent snapshot of the GNI
+	// database. All CSV files of the dump reflect the state of the database
+	// at this moment.
+	SnapshotAt time.Time `json:"snapshotAt"`
+
+	// ResumedSnapshots are snapshot times of resumed runs of the dump. If
+	// the dump was resumed, its files might reflect different states of the
+	// GNI database.
+	ResumedSnapshots []time.Time `json:"resumedSnapshots,omitempty"`
+
+	// Sources are IDs of data-sources of an incremental dump. Such dump
+	// contains indices of these data-sources only, and name-strings used by
+	// them. A full dump has no Sources.
+	Sources []int `json:"sources,omitempty"`
+
+	// CreatedAt is the UTC time when the dump was finished.
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Files describes CSV files of the dump.
+	Files []File `json:"files"`
+}
+
+// File describes one CSV file of the dump.
+type File struct {
+	// Table is the name of GNI table the file was created from.
+	Table string `json:"table"`
+
+	// Name is the name of the file in the dump directory.
+	Name string `json:"name"`
+
+	// Header contains names of the CSV columns.
+	Header []string `json:"header"`
+
+	// Rows is the number of data rows, the header is not counted.
+	Rows int64 `json:"rows"`
+
+	// Bytes is the size of the file.
+	Bytes int64 `json:"bytes"`
+
+	// SHA256 is the hex-encoded SHA-256 checksum of the file.
+	SHA256 string `json:"sha256"`
+}
+
+// IsIncremental is true if the dump contains only some of data-sources.
+func (m Manifest) IsIncremental() bool {
+	return len(m.Sources) > 0
+}
+
+// File returns the description of the file created from the given table.
+func (m Manifest) File(table string) (File, bool) {
+	for _, v := range m.Files {
+		if v.Table == table {
+			return v, true
+		}
+	}
+	return File{}, false
+}
+
+// CheckHeader compares CSV columns of the file with the columns of its
+// table in the current layout.
+func (f File) CheckHeader() error {
+	want, ok := Headers[f.Table]
+	if !ok {
+		return fmt.Errorf("%s is created from unknown table '%s'", f.Name, f.Table)
+	}
+	if !slices.Equal(f.Header, want) {
+		return fmt.Errorf(
+			"%s has columns %v, expected %v", f.Name, f.Header, want,
+		)
+	}
+	return nil
+}
+
+// Verify compares the size and the checksum of the file in the given
+// directory with the description.
+func (f File) Verify(dir string) error {
+	fh, err := os.Open(filepath.Join(dir, f.Name))
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	info, err := fh.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != f.Bytes {
+		return fmt.Errorf(
+			"%s is truncated or modified: size is %d bytes, expected %d",
+			f.Name, info.Size(), f.Bytes,
+		)
+	}
+
+	h := sha256.New()
+	if _, err = io.Copy(h, fh); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != f.SHA256 {
+		return fmt.Errorf("%s does not match its checksum", f.Name)
+	}
+	return nil
+}
@@ -1,7 +1,5 @@
 package kv
 
-import "github.com/dgraph-io/badger/v2"
-
 // KeyVal is a key-value store.
 type KeyVal interface {
 	// Open opens a key-value store.
@@ -10,9 +8,28 @@ type KeyVal interface {
 	// Close closes a key-value store.
 	Close() error
 
-	// GetTransaction returns a transaction object.
-	GetTransaction() (*badger.Txn, error)
+	// Reset removes all data from an open key-value store.
+	Reset() error
+
+	// NewBatch returns a writer that saves key-value pairs in batches.
+	// Every goroutine should use its own batch.
+	NewBatch() (Batch, error)
 
-	// Set sets a key-value pair.
+	// GetValue returns a value for a given key. It returns nil if the key
+	// is not found.
 	GetValue(key []byte) ([]byte, error)
+
+	// GetValues returns values for given keys using one read. Values of
+	// keys that are not found are nil.
+	GetValues(keys [][]byte) ([][]byte, error)
+}
+
+// Batch collects key-value pairs and saves them to the store.
+type Batch interface {
+	// Set adds a key-value pair to the batch. Pairs are saved to the store
+	// when the batch gets large enough.
+	Set(key, value []byte) error
+
+	// Commit saves remaining pairs of the batch to the store.
+	Commit() error
 }
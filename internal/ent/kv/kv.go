@@ -1,5 +1,19 @@
 package kv
 
+// Types of key-value stores.
+const (
+	// Badger is a store based on BadgerDB, it is used by default.
+	Badger = "badger"
+
+	// Bolt is a store based on bbolt. It is slower on writes than Badger,
+	// but keeps everything in one file.
+	Bolt = "bbolt"
+
+	// Memory is a store that keeps data in a map. It is suitable for small
+	// builds and tests.
+	Memory = "memory"
+)
+
 // Record is a key-value pair to be stored in KV store.
 type Record struct {
 	// Key is the key of the record.
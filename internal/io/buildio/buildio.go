@@ -1,9 +1,12 @@
 package buildio
 
 import (
+	"context"
 	"log/slog"
+	"slices"
 
 	"github.com/gnames/gnidump/internal/ent/build"
+	"github.com/gnames/gnidump/internal/ent/datasource"
 	"github.com/gnames/gnidump/internal/ent/kv"
 	"github.com/gnames/gnidump/pkg/config"
 	"github.com/gnames/gnidump/pkg/ent/model"
@@ -17,6 +20,16 @@ type buildio struct {
 	cfg    config.Config
 	kvSci  kv.KeyVal
 	kvVern kv.KeyVal
+
+	// sources are IDs of data-sources of per-source rebuild.
+	sources map[string]struct{}
+
+	// registry provides metadata of data-sources missing in the dump.
+	registry datasource.Registry
+
+	// noParserVersion is true when a dry-run reparse finds a database of an
+	// older gnidump without the parser_version column.
+	noParserVersion bool
 }
 
 // New returns a new instance of Builder
@@ -25,10 +38,17 @@ func New(
 	kvSci, kvVern kv.KeyVal) (build.Builder, error) {
 	var err error
 	var db *pgxpool.Pool
+	cfg.Sources = slices.Compact(slices.Sorted(slices.Values(cfg.Sources)))
 	res := buildio{
-		cfg:    cfg,
-		kvSci:  kvSci,
-		kvVern: kvVern,
+		cfg:     cfg,
+		kvSci:   kvSci,
+		kvVern:  kvVern,
+		sources: sourcesSet(cfg.Sources),
+	}
+	res.registry, err = datasource.Load(cfg.InputDir)
+	if err != nil {
+		slog.Error("Cannot load data-sources registry", "error", err)
+		return nil, err
 	}
 	db, err = pgxConn(cfg)
 	if err != nil {
@@ -61,6 +81,30 @@ func Create(cfg config.Config) error {
 		return err
 	}
 	res.db = db
+	defer db.Close()
+
+	ctx := context.Background()
+	unlock, err := lockStaging(ctx, cfg, db)
+	if err != nil {
+		slog.Error("Cannot lock staging schema", "error", err)
+		return err
+	}
+	defer unlock()
+
+	tables, err := res.schemaTables(ctx)
+	if err != nil {
+		slog.Error("Cannot read tables of database", "error", err)
+		return err
+	}
+	if err = res.confirmReset(tables); err != nil {
+		return err
+	}
+	if res.cfg.Backup && !isEmptySchema(tables) {
+		if err = res.backupTables(ctx, tables); err != nil {
+			return err
+		}
+	}
+
 	err = res.resetDB()
 	if err != nil {
 		slog.Error("Cannot reset database", "error", err)
@@ -76,58 +120,38 @@ func Create(cfg config.Config) error {
 }
 
 // Build reads CSV dump files and imports their data to Postgres DB.
-func (b *buildio) Build() error {
-	var err error
+// Only stages selected in the configuration are executed. Canceling the
+// context stops the running stage.
+func (b *buildio) Build(ctx context.Context) error {
 	defer b.db.Close()
-	// import scientific names data
-	// if err = b.importNameStrings(); err != nil {
-	// 	slog.Error("Cannot import name-strings", "error", err)
-	// 	return err
-	// }
-	// if err = b.importDataSources(); err != nil {
-	// 	slog.Error("Cannot import data-sources", "error", err)
-	// 	return err
-	// }
-	// if err = b.importNameIndices(); err != nil {
-	// 	slog.Error("Cannot import name-string-indices", "error", err)
-	// 	return err
-	// }
-	//
-	// // import vernacular data
-	// if err = b.importVern(); err != nil {
-	// 	slog.Error("Cannot import vernacular_strings", "error", err)
-	// 	return err
-	// }
-	// if err = b.importVernIndices(); err != nil {
-	// 	slog.Error("Cannot import vernacular_indices", "error", err)
-	// 	return err
-	// }
 
-	if err = b.reparse(); err != nil {
-		slog.Error("Cannot reparse name_strings", "error", err)
+	stages, err := b.selectStages()
+	if err != nil {
+		slog.Error("Cannot select rebuild stages", "error", err)
 		return err
 	}
 
-	if err = b.fixVernLang(); err != nil {
-		slog.Error("Cannot fix vernacular language", "error", err)
+	unlock, err := lockStaging(ctx, b.cfg, b.db)
+	if err != nil {
+		slog.Error("Cannot lock staging schema", "error", err)
 		return err
 	}
+	defer unlock()
 
-	// finish import by creating words and verification tables
-	if err = b.removeOrphans(); err != nil {
-		slog.Error("Cannot remove orphans", "error", err)
-		return err
-	}
-	if err = b.createWords(); err != nil {
-		slog.Error("Cannot create words", "error", err)
+	if err = b.initParserVersion(ctx); err != nil {
+		slog.Error("Cannot add parser version to database", "error", err)
 		return err
 	}
-	if err = b.createVerification(); err != nil {
-		slog.Error("Cannot create verification", "error", err)
-		return err
+
+	if b.isIncremental() {
+		slog.Info("Rebuilding data-sources", "sources", b.cfg.Sources)
+		if err = b.initRebuildTables(ctx); err != nil {
+			slog.Error("Cannot create tables of per-source rebuild", "error", err)
+			return err
+		}
 	}
 
-	return nil
+	return b.runStages(ctx, stages)
 }
 
 func (b *buildio) migrate() error {
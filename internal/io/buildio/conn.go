@@ -17,7 +17,11 @@ func pgxConn(cfg config.Config) (*pgxpool.Pool, error) {
 		slog.Error("Cannot parse pgx config", "error", err)
 		return nil, err
 	}
-	pgxCfg.MaxConns = 15
+	// every database writer of an import needs its own connection
+	pl := cfg.Pipelines
+	writers := max(pl.NameStrings.Writers, pl.NameIndices.Writers,
+		pl.VernStrings.Writers, pl.VernIndices.Writers)
+	pgxCfg.MaxConns = int32(max(15, writers+5))
 
 	db, err := pgxpool.NewWithConfig(
 		context.Background(),
@@ -39,7 +43,10 @@ func gormConn(cfg config.Config) (*gorm.DB, error) {
 	return db, nil
 }
 
+// opts returns connection settings. Connections of a shadow build use the
+// staging schema.
 func opts(cfg config.Config) string {
-	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s sslmode=disable",
-		cfg.PgHost, cfg.PgUser, cfg.PgPass, cfg.PgDB)
+	return fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s sslmode=disable search_path=%s",
+		cfg.PgHost, cfg.PgUser, cfg.PgPass, cfg.PgDB, schema(cfg))
 }
@@ -4,24 +4,29 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 
 	"github.com/gnames/gnidump/internal/str"
 	"github.com/gnames/gnidump/pkg/ent/model"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
-// resetDB resets the database to a clean state.
+// resetDB resets the database schema to a clean state.
 func (b *buildio) resetDB() error {
 	var err error
 	var rows pgx.Rows
-	slog.Info("Resetting database")
+	sch := schema(b.cfg)
+	slog.Info("Resetting database", "schema", sch)
 	qs := []string{
-		"DROP SCHEMA IF EXISTS public CASCADE",
-		"CREATE SCHEMA public",
-		"GRANT ALL ON SCHEMA public TO postgres",
-		fmt.Sprintf("GRANT ALL ON SCHEMA public TO %s", b.cfg.PgUser),
-		"COMMENT ON SCHEMA public IS 'standard public schema'",
+		fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", sch),
+		fmt.Sprintf("CREATE SCHEMA %s", sch),
+		fmt.Sprintf("GRANT ALL ON SCHEMA %s TO postgres", sch),
+		fmt.Sprintf("GRANT ALL ON SCHEMA %s TO %s", sch, b.cfg.PgUser),
+	}
+	if sch == publicSchema {
+		qs = append(qs, "COMMENT ON SCHEMA public IS 'standard public schema'")
 	}
 	for i := range qs {
 		rows, err = b.db.Query(context.Background(), qs[i])
@@ -59,25 +64,91 @@ func (b *buildio) insertRows(tbl string, columns []string, rows [][]any) (int64,
 	return int64(copyCount), err
 }
 
+// upsertRows adds rows to a table skipping rows that already exist.
+// Rows are copied to a temporary table first and then inserted to the
+// table in one statement. Queries given in before run in the same
+// transaction before the insert and can use the temporary table.
+func (b *buildio) upsertRows(
+	tbl string,
+	columns []string,
+	rows [][]any,
+	before ...string,
+) (int64, error) {
+	var res int64
+	ctx := context.Background()
+	tmp := "tmp_" + tbl
+	cols := strings.Join(columns, ", ")
+	err := pgx.BeginFunc(ctx, b.db, func(tx pgx.Tx) error {
+		q := fmt.Sprintf(
+			"CREATE TEMP TABLE %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP",
+			tmp, tbl,
+		)
+		if _, err := tx.Exec(ctx, q); err != nil {
+			return err
+		}
+		_, err := tx.CopyFrom(ctx, pgx.Identifier{tmp}, columns,
+			pgx.CopyFromRows(rows))
+		if err != nil {
+			return err
+		}
+		for _, q = range before {
+			if _, err = tx.Exec(ctx, q); err != nil {
+				return err
+			}
+		}
+		q = fmt.Sprintf(
+			"INSERT INTO %s (%s) SELECT %s FROM %s ON CONFLICT DO NOTHING",
+			tbl, cols, cols, tmp,
+		)
+		tag, err := tx.Exec(ctx, q)
+		if err != nil {
+			return err
+		}
+		res = tag.RowsAffected()
+		return nil
+	})
+	return res, err
+}
+
 func (b *buildio) saveNameStrings(ns []model.NameString) (int64, error) {
 	columns := []string{
 		"id", "name", "year", "cardinality", "canonical_id",
 		"canonical_full_id", "canonical_stem_id", "virus",
-		"bacteria", "surrogate", "parse_quality"}
+		"bacteria", "surrogate", "parse_quality", "parser_version"}
 	rows := make([][]any, len(ns))
 	for i, n := range ns {
 		rows[i] = []any{
 			n.ID, n.Name, n.Year, n.Cardinality,
 			n.CanonicalID, n.CanonicalFullID, n.CanonicalStemID,
-			n.Virus, n.Bacteria, n.Surrogate, n.ParseQuality,
+			n.Virus, n.Bacteria, n.Surrogate, n.ParseQuality, n.ParserVersion,
 		}
 	}
+	if b.isIncremental() {
+		// new name-strings need words
+		q := `
+INSERT INTO rebuild_names (id, is_new)
+	SELECT t.id, TRUE
+		FROM tmp_name_strings t
+		WHERE NOT EXISTS (SELECT 1 FROM name_strings ns WHERE ns.id = t.id)
+	ON CONFLICT (id) DO UPDATE SET is_new = TRUE`
+		return b.upsertRows("name_strings", columns, rows, q)
+	}
 	return b.insertRows("name_strings", columns, rows)
 }
 
 func (b *buildio) saveCanonicals(cs []canonicalData) error {
+	return insertCanonicals(context.Background(), b.db, cs)
+}
+
+// execer is implemented by pgxpool.Pool and pgx.Tx.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// insertCanonicals adds canonical forms that do not exist yet. It runs in
+// a transaction if db is a pgx.Tx.
+func insertCanonicals(ctx context.Context, db execer, cs []canonicalData) error {
 	var err error
-	var rows pgx.Rows
 	cal := make([]string, len(cs))
 	calFull := make([]string, 0, len(cs))
 	calStem := make([]string, 0, len(cs))
@@ -94,29 +165,32 @@ func (b *buildio) saveCanonicals(cs []canonicalData) error {
 		}
 	}
 
+	// Parallel writers insert the same canonical forms. Rows sorted by ID
+	// are locked in the same order, so the inserts do not deadlock.
+	slices.Sort(cal)
+	slices.Sort(calFull)
+	slices.Sort(calStem)
+
 	q0 := `INSERT INTO %s (id, name) VALUES %s ON CONFLICT DO NOTHING`
 	q := fmt.Sprintf(q0, "canonicals", strings.Join(cal, ","))
-	if rows, err = b.db.Query(context.Background(), q); err != nil {
+	if _, err = db.Exec(ctx, q); err != nil {
 		slog.Error("save canonicals failed", "error", err)
 		return err
 	}
-	rows.Close()
 
 	if len(calFull) > 0 {
 		q = fmt.Sprintf(q0, "canonical_fulls", strings.Join(calFull, ","))
-		if rows, err = b.db.Query(context.Background(), q); err != nil {
+		if _, err = db.Exec(ctx, q); err != nil {
 			slog.Error("save canonical_fulls failed", "error", err)
 			return err
 		}
-		rows.Close()
 	}
 	if len(calStem) > 0 {
 		q = fmt.Sprintf(q0, "canonical_stems", strings.Join(calStem, ","))
-		if rows, err = b.db.Query(context.Background(), q); err != nil {
+		if _, err = db.Exec(ctx, q); err != nil {
 			slog.Error("save canonical_stems failed", "error", err)
 			return err
 		}
-		rows.Close()
 	}
 	return nil
 }
@@ -126,17 +200,17 @@ func (b *buildio) saveNameStringIndices(
 ) (int64, error) {
 	columns := []string{
 		"data_source_id", "name_string_id", "record_id",
-		"local_id", "global_id", "outlink_id", "code_id", "rank",
-		"accepted_record_id", "classification", "classification_ids",
-		"classification_ranks"}
+		"local_id", "global_id", "name_id", "outlink_id", "code_id", "rank",
+		"taxonomic_status", "accepted_record_id", "classification",
+		"classification_ids", "classification_ranks"}
 	rows := make([][]any, len(nsi))
 	for i := range nsi {
 		row := []any{
 			nsi[i].DataSourceID, nsi[i].NameStringID, nsi[i].RecordID,
-			nsi[i].LocalID, nsi[i].GlobalID, nsi[i].OutlinkID,
-			nsi[i].CodeID, nsi[i].Rank, nsi[i].AcceptedRecordID,
-			nsi[i].Classification, nsi[i].ClassificationIDs,
-			nsi[i].ClassificationRanks,
+			nsi[i].LocalID, nsi[i].GlobalID, nsi[i].NameID, nsi[i].OutlinkID,
+			nsi[i].CodeID, nsi[i].Rank, nsi[i].TaxonomicStatus,
+			nsi[i].AcceptedRecordID, nsi[i].Classification,
+			nsi[i].ClassificationIDs, nsi[i].ClassificationRanks,
 		}
 		rows[i] = row
 	}
@@ -151,6 +225,9 @@ func (b *buildio) saveVernStrings(vs []model.VernacularString) (int64, error) {
 		rows[i] = []any{v.ID, v.Name}
 	}
 
+	if b.isIncremental() {
+		return b.upsertRows("vernacular_strings", columns, rows)
+	}
 	return b.insertRows("vernacular_strings", columns, rows)
 }
 
@@ -172,6 +249,13 @@ func (b *buildio) getWordNames() (pgx.Rows, error) {
 	var err error
 	ctx := context.Background()
 	q := "SELECT name FROM name_strings"
+	if b.isIncremental() {
+		q = `
+SELECT ns.name
+	FROM name_strings ns
+		JOIN rebuild_names rn ON rn.id = ns.id
+	WHERE rn.is_new`
+	}
 	rows, err := b.db.Query(ctx, q)
 	if err != nil {
 		slog.Error("Cannot get names from db", "error", err)
@@ -189,6 +273,10 @@ func (b *buildio) saveNameWords(wns []model.WordNameString) error {
 		row := []any{v.WordID, v.NameStringID, v.CanonicalID}
 		rows[i] = row
 	}
+	if b.isIncremental() {
+		_, err = b.upsertRows("word_name_strings", columns, rows)
+		return err
+	}
 	_, err = b.insertRows("word_name_strings", columns, rows)
 	return err
 }
@@ -201,6 +289,10 @@ func (b *buildio) saveWords(ws []model.Word) error {
 		rows[i] = row
 	}
 
+	if b.isIncremental() {
+		_, err := b.upsertRows("words", columns, rows)
+		return err
+	}
 	_, err := b.insertRows("words", columns, rows)
 	return err
 }
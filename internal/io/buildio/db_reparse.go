@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
 	"log/slog"
 	"os"
 	"strings"
@@ -12,23 +11,124 @@ import (
 	"time"
 
 	"github.com/dustin/go-humanize"
+	"github.com/gnames/gnidump/pkg/ent/model"
 	"github.com/gnames/gnparser"
-	"github.com/gnames/gnparser/ent/parsed"
-	"github.com/gnames/gnuuid"
+	"github.com/jackc/pgx/v5"
 	"golang.org/x/sync/errgroup"
 )
 
+// reparsed is a name-string with the results of its parsing saved in the
+// database.
 type reparsed struct {
 	nameStringID, name                            string
 	canonicalID, canonicalFullID, canonicalStemID sql.NullString
 	canonical, canonicalFull, canonicalStem       string
+	cardinality                                   sql.NullInt32
+	year                                          sql.NullInt16
 	bacteria, surrogate, virus                    bool
 	parseQuality                                  int
 }
 
-func (b *buildio) reparse() error {
+// reparseChange is a name-string with new results of parsing that differ
+// from the saved ones.
+type reparseChange struct {
+	old reparsed
+	new model.NameString
+
+	// cans contains new canonical forms of the name-string, it is empty if
+	// the name-string cannot be parsed.
+	cans []canonicalData
+}
+
+// Reparse parses name-strings of the database again. Changes are written
+// to the report and, unless DryRun is set, saved to the database.
+// Name-strings can be limited by the version of gnparser that parsed them,
+// by data-sources and by parse quality.
+func (b *buildio) Reparse() error {
+	defer b.db.Close()
+	ctx := context.Background()
+
+	// dry run does not change the schema of an older database
+	if b.cfg.DryRun {
+		ok, err := b.hasParserVersion(ctx)
+		if err != nil {
+			slog.Error("Cannot check parser version column", "error", err)
+			return err
+		}
+		b.noParserVersion = !ok
+	} else if err := b.initParserVersion(ctx); err != nil {
+		slog.Error("Cannot add parser version to database", "error", err)
+		return err
+	}
+
+	if err := b.reparse(true); err != nil {
+		return err
+	}
+	if b.cfg.DryRun {
+		return nil
+	}
+	return b.saveParserVersion(ctx)
+}
+
+// reparseStage parses name-strings again during rebuild the same way as
+// Reparse, but without a report of changes.
+func (b *buildio) reparseStage() error {
+	ctx := context.Background()
+	if err := b.initParserVersion(ctx); err != nil {
+		slog.Error("Cannot add parser version to database", "error", err)
+		return err
+	}
+	if err := b.reparse(false); err != nil {
+		return err
+	}
+	return b.saveParserVersion(ctx)
+}
+
+// saveParserVersion records the current version of gnparser for reparsed
+// name-strings and, if all of them were reparsed, in build metadata.
+func (b *buildio) saveParserVersion(ctx context.Context) error {
+	if err := b.stampParserVersion(ctx); err != nil {
+		slog.Error("Cannot update parser version", "error", err)
+		return err
+	}
+
+	if !b.isReparseFiltered() {
+		if err := b.saveParserMetadata(ctx); err != nil {
+			slog.Error("Cannot save build metadata", "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// stampParserVersion sets the current version of gnparser to reparsed
+// name-strings. Changed name-strings already have it, the rest were
+// parsed with the same results.
+func (b *buildio) stampParserVersion(ctx context.Context) error {
+	where, args, err := b.reparseFilter(2)
+	if err != nil {
+		return err
+	}
+	q := fmt.Sprintf(`
+UPDATE name_strings ns
+	SET parser_version = $1
+	WHERE ns.parser_version IS DISTINCT FROM $1 AND %s`, where)
+	args = append([]any{gnparser.Version}, args...)
+	tag, err := b.db.Exec(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	slog.Info("Updated parser version",
+		"version", gnparser.Version, "names", humanize.Comma(tag.RowsAffected()))
+	return nil
+}
+
+// reparse parses all name-strings again and saves results that changed.
+// Changes are saved in batches by set-based queries. If withReport is true,
+// changes are also written to the reparse report.
+func (b *buildio) reparse(withReport bool) error {
 	chIn := make(chan reparsed)
-	chOut := make(chan reparsed)
+	chOut := make(chan reparseChange)
 	var wg sync.WaitGroup
 
 	g, ctx := errgroup.WithContext(context.Background())
@@ -38,7 +138,7 @@ func (b *buildio) reparse() error {
 		return b.loadReparse(ctx, chIn)
 	})
 
-	for i := 0; i < 50; i++ {
+	for i := 0; i < b.cfg.JobsNum; i++ {
 		wg.Add(1)
 		g.Go(func() error {
 			defer wg.Done()
@@ -47,7 +147,7 @@ func (b *buildio) reparse() error {
 	}
 
 	g.Go(func() error {
-		return b.saveReparse(ctx, chOut)
+		return b.saveReparse(ctx, chOut, withReport)
 	})
 
 	go func() {
@@ -68,13 +168,30 @@ func (b *buildio) loadReparse(
 	ctx context.Context,
 	chIn chan<- reparsed,
 ) error {
+	where, args, err := b.reparseFilter(1)
+	if err != nil {
+		return err
+	}
+	if b.isReparseFiltered() {
+		slog.Info("Selecting names for reparse",
+			"older-than", b.cfg.ReparseOlderThan,
+			"sources", b.cfg.Sources,
+			"parse-quality", b.cfg.ParseQualities,
+		)
+	}
+
 	q := `
 SELECT
-	id, name, canonical_id, canonical_full_id, canonical_stem_id, bacteria,
-	virus, surrogate, parse_quality
-FROM name_strings
-`
-	rows, err := b.db.Query(ctx, q)
+	ns.id, ns.name, ns.canonical_id, ns.canonical_full_id,
+	ns.canonical_stem_id, COALESCE(c.name, ''), COALESCE(cf.name, ''),
+	COALESCE(cs.name, ''), ns.cardinality, ns.year, ns.bacteria, ns.virus,
+	ns.surrogate, ns.parse_quality
+FROM name_strings ns
+	LEFT JOIN canonicals c ON c.id = ns.canonical_id
+	LEFT JOIN canonical_fulls cf ON cf.id = ns.canonical_full_id
+	LEFT JOIN canonical_stems cs ON cs.id = ns.canonical_stem_id
+WHERE ` + where
+	rows, err := b.db.Query(ctx, q, args...)
 	if err != nil {
 		return err
 	}
@@ -88,8 +205,9 @@ FROM name_strings
 		err = rows.Scan(
 			&res.nameStringID, &res.name, &res.canonicalID,
 			&res.canonicalFullID, &res.canonicalStemID,
-			&res.bacteria, &res.virus, &res.surrogate,
-			&res.parseQuality,
+			&res.canonical, &res.canonicalFull, &res.canonicalStem,
+			&res.cardinality, &res.year, &res.bacteria, &res.virus,
+			&res.surrogate, &res.parseQuality,
 		)
 		if err != nil {
 			return err
@@ -98,8 +216,7 @@ FROM name_strings
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		default:
-			chIn <- res
+		case chIn <- res:
 		}
 
 		if count%100_000 == 0 {
@@ -110,190 +227,206 @@ FROM name_strings
 				humanize.Comma(int64(count)), humanize.Comma(speed))
 		}
 	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
 
 	fmt.Fprintf(os.Stderr, "\r%s\r", strings.Repeat(" ", 40))
 	slog.Info("Finished names reparsing")
 	return nil
 }
 
+// workerReparse parses name-strings and sends out those whose results of
+// parsing changed. New results are prepared the same way as during the
+// import of name-strings.
 func (b *buildio) workerReparse(
 	ctx context.Context,
 	chIn <-chan reparsed,
-	chOut chan<- reparsed,
+	chOut chan<- reparseChange,
 ) error {
 	prsCfg := gnparser.NewConfig()
 	prs := gnparser.New(prsCfg)
 	for r := range chIn {
-		select {
-		case <-ctx.Done():
-			for range chIn {
-			}
-			return ctx.Err()
-		default:
-		}
-
-		var canonicalID, canonicalFullID, canonicalStemID string
-		// there might be update in this case too
-		// TODO incorporate it into reparsing.
 		parsed := prs.ParseName(r.name)
 		if parsed.ParseQuality+r.parseQuality == 0 {
 			continue
 		}
 
-		if !parsed.Parsed {
-			chOut <- reparsed{
-				nameStringID:    r.nameStringID,
-				name:            r.name,
-				canonicalID:     newNullStr(""),
-				canonicalFullID: newNullStr(""),
-				canonicalStemID: newNullStr(""),
-				canonical:       "",
-				canonicalFull:   "",
-				canonicalStem:   "",
-				bacteria:        false,
-				virus:           false,
-				surrogate:       false,
-				parseQuality:    parsed.ParseQuality,
-			}
-			continue
-		}
-
-		canonicalID = gnuuid.New(parsed.Canonical.Full).String()
-		if parsedIsSame(r, parsed, canonicalID) {
+		cans, n := b.prepareCansAndName(parsed, nil)
+		if isSameParse(r, n) {
 			continue
 		}
 
-		if parsed.Canonical.Simple != parsed.Canonical.Full {
-			canonicalFullID = gnuuid.New(parsed.Canonical.Full).String()
-		} else {
-			parsed.Canonical.Full = ""
-		}
-		canonicalStemID = gnuuid.New(parsed.Canonical.Stemmed).String()
-
-		chOut <- reparsed{
-			nameStringID:    r.nameStringID,
-			name:            r.name,
-			canonicalID:     newNullStr(canonicalID),
-			canonicalFullID: newNullStr(canonicalFullID),
-			canonicalStemID: newNullStr(canonicalStemID),
-			canonical:       parsed.Canonical.Simple,
-			canonicalFull:   parsed.Canonical.Full,
-			canonicalStem:   parsed.Canonical.Stemmed,
-			bacteria:        parsed.Bacteria != nil && parsed.Bacteria.Bool(),
-			virus:           parsed.Virus,
-			surrogate:       parsed.Surrogate != nil,
-			parseQuality:    parsed.ParseQuality,
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case chOut <- reparseChange{old: r, new: n, cans: cans}:
 		}
 	}
 	return nil
 }
 
-func parsedIsSame(r reparsed, parsed parsed.Parsed, canonicalID string) bool {
-	if r.canonicalID.String != canonicalID {
-		return false
-	}
-	if r.surrogate != (parsed.Surrogate != nil) {
-		return false
-	}
-	if r.bacteria != (parsed.Bacteria != nil && parsed.Bacteria.Bool()) {
-		return false
-	}
-	if r.virus != parsed.Virus {
-		return false
-	}
-	return true
-}
-
-func newNullStr(s string) sql.NullString {
-	if s == "" {
-		return sql.NullString{}
-	}
-	return sql.NullString{String: s, Valid: true}
+// isSameParse checks if new results of parsing are the same as the saved
+// ones. All fields saved by updateNameStrings are compared, otherwise a
+// changed name-string would be stamped with the new parser version without
+// being updated.
+func isSameParse(r reparsed, n model.NameString) bool {
+	return r.canonicalID == n.CanonicalID &&
+		r.canonicalFullID == n.CanonicalFullID &&
+		r.canonicalStemID == n.CanonicalStemID &&
+		r.cardinality == n.Cardinality &&
+		r.year == n.Year &&
+		r.bacteria == n.Bacteria &&
+		r.virus == n.Virus &&
+		r.surrogate == n.Surrogate &&
+		r.parseQuality == n.ParseQuality
 }
 
+// saveReparse writes changed name-strings to the report if withReport is
+// true, collects them into batches and saves them to the database. In
+// dry-run mode nothing is saved to the database.
 func (b *buildio) saveReparse(
 	ctx context.Context,
-	chOut <-chan reparsed,
+	chOut <-chan reparseChange,
+	withReport bool,
 ) error {
-	// Open the log file in current directory.
-	file, err := os.OpenFile("reparse.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open log file: %w", err)
+	var report *reparseReport
+	var err error
+	if withReport {
+		report, err = b.newReparseReport()
+		if err != nil {
+			slog.Error("Cannot create reparse report", "error", err)
+			return err
+		}
+		defer report.Close()
 	}
-	defer file.Close()
 
-	// Create a logger that writes to the file.
-	logger := log.New(file, "", log.LstdFlags)
+	var total int64
+	batch := make([]reparseChange, 0, b.cfg.BatchSize)
+	save := func() error {
+		if len(batch) == 0 || b.cfg.DryRun {
+			batch = batch[:0]
+			return nil
+		}
+		if err := b.updateNameStrings(ctx, batch); err != nil {
+			slog.Error("Cannot save reparsed names", "error", err)
+			return err
+		}
+		total += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			logger.Println("Context cancelled, stopping reparse logging.")
 			return ctx.Err()
 		case r, ok := <-chOut:
 			if !ok {
-				return nil // Channel closed, we're done
+				if err = save(); err != nil {
+					return err
+				}
+				if report != nil {
+					report.Summary(os.Stderr)
+					if err = report.Close(); err != nil {
+						return err
+					}
+				}
+				if b.cfg.DryRun {
+					slog.Info("Dry run, database is not changed")
+					return nil
+				}
+				slog.Info("Updated reparsed names", "names", humanize.Comma(total))
+				return nil
+			}
+			if report != nil {
+				if err = report.Write(r); err != nil {
+					slog.Error("Cannot write reparse report", "error", err)
+					return err
+				}
+			}
+
+			batch = append(batch, r)
+			if len(batch) == b.cfg.BatchSize {
+				if err = save(); err != nil {
+					return err
+				}
 			}
-			b.updateNameString(ctx, r)
-			// Use the logger to write to the file instead of fmt.Printf.
-			logger.Printf("Name: %s, Can: %s, Q: %d", r.name, r.canonical, r.parseQuality)
 		}
 	}
 }
 
-func (b *buildio) updateNameString(ctx context.Context, r reparsed) error {
-	tx, err := b.db.Begin(ctx)
-	if err != nil {
-		return fmt.Errorf("begin transaction: %w", err)
-	}
-	defer tx.Rollback(ctx) // Rollback in case of any error
-
-	_, err = tx.Exec(ctx, `
-		UPDATE name_strings
-		SET
-			canonical_id = $1, canonical_full_id = $2, canonical_stem_id = $3
-			bacteria = $4, virus = $5, surrogate = $6, parse_quality = $7,
-		WHERE id = $8`,
-		r.canonicalID, r.canonicalFullID, r.canonicalStemID,
-		r.bacteria, r.virus, r.surrogate, r.parseQuality, r.nameStringID,
-	)
-	if err != nil {
-		return fmt.Errorf("update name_strings: %w", err)
-	}
-
-	if r.parseQuality == 0 {
-		return tx.Commit(ctx)
+// updateNameStrings saves a batch of reparsed name-strings. The batch is
+// copied to a temporary table and name_strings are updated from it by one
+// query. New canonical forms are added in bulk in the same transaction, so
+// a failed batch leaves no canonical forms without name-strings.
+func (b *buildio) updateNameStrings(
+	ctx context.Context,
+	batch []reparseChange,
+) error {
+	var cans []canonicalData
+	columns := []string{
+		"id", "canonical_id", "canonical_full_id", "canonical_stem_id",
+		"cardinality", "year", "bacteria", "virus", "surrogate", "parse_quality",
+		"parser_version",
 	}
-
-	_, err = tx.Exec(ctx, `
-		INSERT INTO canonicals (id, name)
-		VALUES ($1, $2)
-		ON CONFLICT (id) DO NOTHING`,
-		r.canonicalID, r.canonical)
-	if err != nil {
-		return fmt.Errorf("insert into canonicals: %w", err)
+	rows := make([][]any, len(batch))
+	for i, v := range batch {
+		n := v.new
+		rows[i] = []any{
+			n.ID, n.CanonicalID, n.CanonicalFullID, n.CanonicalStemID,
+			n.Cardinality, n.Year, n.Bacteria, n.Virus, n.Surrogate,
+			n.ParseQuality, n.ParserVersion,
+		}
+		cans = append(cans, v.cans...)
 	}
 
-	_, err = tx.Exec(ctx, `
-		INSERT INTO canonical_stems (id, name)
-		VALUES ($1, $2)
-		ON CONFLICT (id) DO NOTHING`,
-		r.canonicalStemID, r.canonicalStem)
-	if err != nil {
-		return fmt.Errorf("insert into canonical_stems: %w", err)
-	}
+	return pgx.BeginFunc(ctx, b.db, func(tx pgx.Tx) error {
+		if len(cans) > 0 {
+			if err := insertCanonicals(ctx, tx, cans); err != nil {
+				return err
+			}
+		}
 
-	if r.canonicalFull != "" {
-		_, err = tx.Exec(ctx, `
-		INSERT INTO canonical_fulls (id, name)
-		VALUES ($1, $2)
-		ON CONFLICT (id) DO NOTHING`,
-			r.canonicalFullID, r.canonicalFull)
+		q := `
+CREATE TEMP TABLE reparse_batch (
+	id UUID PRIMARY KEY,
+	canonical_id UUID,
+	canonical_full_id UUID,
+	canonical_stem_id UUID,
+	cardinality INT,
+	year INT,
+	bacteria BOOL,
+	virus BOOL,
+	surrogate BOOL,
+	parse_quality INT,
+	parser_version VARCHAR(50)
+) ON COMMIT DROP`
+		if _, err := tx.Exec(ctx, q); err != nil {
+			return err
+		}
+		_, err := tx.CopyFrom(ctx, pgx.Identifier{"reparse_batch"}, columns,
+			pgx.CopyFromRows(rows))
 		if err != nil {
-			return fmt.Errorf("insert into canonical_fulls: %w", err)
+			return err
 		}
-	}
 
-	// Commit the transaction if all operations were successful
-	return tx.Commit(ctx)
+		q = `
+UPDATE name_strings ns
+	SET
+		canonical_id = r.canonical_id,
+		canonical_full_id = r.canonical_full_id,
+		canonical_stem_id = r.canonical_stem_id,
+		cardinality = r.cardinality,
+		year = r.year,
+		bacteria = r.bacteria,
+		virus = r.virus,
+		surrogate = r.surrogate,
+		parse_quality = r.parse_quality,
+		parser_version = r.parser_version
+	FROM reparse_batch r
+	WHERE ns.id = r.id`
+		_, err = tx.Exec(ctx, q)
+		return err
+	})
 }
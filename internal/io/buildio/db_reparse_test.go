@@ -0,0 +1,55 @@
+package buildio
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/gnames/gnidump/pkg/ent/model"
+)
+
+func TestIsSameParse(t *testing.T) {
+	canID := sql.NullString{String: "can", Valid: true}
+	r := reparsed{
+		canonicalID:  canID,
+		cardinality:  sql.NullInt32{Int32: 2, Valid: true},
+		year:         sql.NullInt16{Int16: 1758, Valid: true},
+		parseQuality: 1,
+	}
+	same := model.NameString{
+		CanonicalID:  canID,
+		Cardinality:  sql.NullInt32{Int32: 2, Valid: true},
+		Year:         sql.NullInt16{Int16: 1758, Valid: true},
+		ParseQuality: 1,
+	}
+
+	tests := []struct {
+		msg    string
+		change func(*model.NameString)
+		want   bool
+	}{
+		{"same", func(n *model.NameString) {}, true},
+		{"canonical", func(n *model.NameString) {
+			n.CanonicalID.String = "x"
+		}, false},
+		{"cardinality", func(n *model.NameString) {
+			n.Cardinality.Int32 = 3
+		}, false},
+		{"year", func(n *model.NameString) {
+			n.Year.Int16 = 1759
+		}, false},
+		{"no year", func(n *model.NameString) {
+			n.Year = sql.NullInt16{}
+		}, false},
+		{"parse quality", func(n *model.NameString) {
+			n.ParseQuality = 2
+		}, false},
+	}
+
+	for _, v := range tests {
+		n := same
+		v.change(&n)
+		if res := isSameParse(r, n); res != v.want {
+			t.Errorf("%s: got %t, want %t", v.msg, res, v.want)
+		}
+	}
+}
@@ -55,7 +55,12 @@ func (b *buildio) langCodeLowCase() error {
 UPDATE vernacular_string_indices
 	SET lang_code = LOWER(lang_code)
 `
-	_, err := b.db.Exec(context.Background(), q)
+	var args []any
+	if b.isIncremental() {
+		q += "	WHERE data_source_id = ANY($1)"
+		args = append(args, b.cfg.Sources)
+	}
+	_, err := b.db.Exec(context.Background(), q, args...)
 	if err != nil {
 		return err
 	}
@@ -68,7 +73,12 @@ UPDATE vernacular_string_indices
 	SET language_orig = language
 	WHERE language_orig IS NULL
 `
-	_, err := b.db.Exec(ctx, q)
+	var args []any
+	if b.isIncremental() {
+		q += "	AND data_source_id = ANY($1)"
+		args = append(args, b.cfg.Sources)
+	}
+	_, err := b.db.Exec(ctx, q, args...)
 	if err != nil {
 		return err
 	}
@@ -81,7 +91,12 @@ func (b *buildio) loadVern(ctx context.Context, ch chan<- vern) error {
 SELECT ctid, language, lang_code
 	FROM vernacular_string_indices
 `
-	rows, err := b.db.Query(ctx, q)
+	var args []any
+	if b.isIncremental() {
+		q += "	WHERE data_source_id = ANY($1)"
+		args = append(args, b.cfg.Sources)
+	}
+	rows, err := b.db.Query(ctx, q, args...)
 	if err != nil {
 		return err
 	}
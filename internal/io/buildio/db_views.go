@@ -2,7 +2,11 @@ package buildio
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 func (b *buildio) removeOrphans() error {
@@ -136,6 +140,34 @@ SELECT nsi.data_source_id, nsi.record_id, nsi.name_string_id,
 		slog.Error("Cannot create verification index3", "error", err)
 		return err
 	}
+	if err = b.createVerificationRowIndex(ctx); err != nil {
+		slog.Error("Cannot create verification row index", "error", err)
+		return err
+	}
 	slog.Info("View verification is created")
 	return nil
 }
+
+// verificationRowIndex is the name of the unique index of verification
+// view. It allows to refresh the view without blocking its readers.
+const verificationRowIndex = "verification_row_idx"
+
+// createVerificationRowIndex creates a unique index of verification rows.
+// In rare cases indices of a data-source repeat the same record ID and
+// name-string, then the index cannot be created and the view can only be
+// refreshed with a lock that blocks its readers.
+func (b *buildio) createVerificationRowIndex(ctx context.Context) error {
+	q := fmt.Sprintf(`
+CREATE UNIQUE INDEX %s
+	ON verification (data_source_id, record_id, name_string_id)`,
+		verificationRowIndex)
+	_, err := b.db.Exec(ctx, q)
+	// 23505 is unique_violation error of PostgreSQL.
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		slog.Warn("Verification view has repeated records, " +
+			"its refresh will block readers")
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,227 @@
+package buildio
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gnames/gnfmt"
+	"github.com/gnames/gnidump/internal/ent/dump"
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/sync/errgroup"
+)
+
+// manifest reads the manifest of the CSV dump.
+func (b *buildio) manifest() (dump.Manifest, error) {
+	var res dump.Manifest
+	path := filepath.Join(b.cfg.DumpDir, dump.ManifestFile)
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = fmt.Errorf(
+			"dump at '%s' has no %s, it is incomplete or was created by an "+
+				"older version of gnidump", b.cfg.DumpDir, dump.ManifestFile,
+		)
+		return res, err
+	}
+	if err != nil {
+		return res, err
+	}
+	enc := gnfmt.GNjson{}
+	err = enc.Decode(bs, &res)
+	return res, err
+}
+
+// verifyDump checks that CSV files of the given tables are complete and
+// match the manifest of the dump.
+func (b *buildio) verifyDump(tables []string) error {
+	m, err := b.manifest()
+	if err != nil {
+		return err
+	}
+	if m.SchemaVersion != dump.SchemaVersion {
+		return fmt.Errorf(
+			"dump schema version is %d, gnidump supports version %d",
+			m.SchemaVersion, dump.SchemaVersion,
+		)
+	}
+
+	if m.IsIncremental() {
+		if err = b.checkDumpSources(m.Sources); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Importing GNI snapshot",
+		"snapshot", m.SnapshotAt.Format(time.RFC3339),
+		"gnidump", m.GnidumpVersion,
+	)
+	for _, v := range m.ResumedSnapshots {
+		slog.Warn("Dump was resumed, some files come from a later snapshot",
+			"snapshot", v.Format(time.RFC3339))
+	}
+
+	slog.Info("Verifying CSV dump files")
+	var g errgroup.Group
+	for _, tbl := range tables {
+		f, ok := m.File(tbl)
+		if !ok {
+			return fmt.Errorf("manifest has no file for table '%s'", tbl)
+		}
+		g.Go(func() error {
+			return b.verifyFile(f)
+		})
+	}
+	return g.Wait()
+}
+
+// verifyTable checks the CSV file of one table against the manifest of
+// the dump.
+func (b *buildio) verifyTable(table string) error {
+	m, err := b.manifest()
+	if err != nil {
+		return err
+	}
+	f, ok := m.File(table)
+	if !ok {
+		return fmt.Errorf("manifest has no file for table '%s'", table)
+	}
+	return b.verifyFile(f)
+}
+
+// verifyFile checks that columns of a CSV file are the ones the import
+// expects, and compares the size and the checksum of the file with the
+// data from the manifest. The number of rows is checked while the file is
+// read.
+func (b *buildio) verifyFile(f dump.File) error {
+	if err := f.CheckHeader(); err != nil {
+		return err
+	}
+	if err := f.Verify(b.cfg.DumpDir); err != nil {
+		return err
+	}
+	slog.Info("Verified CSV file", "file", f.Name, "rows", f.Rows)
+	return nil
+}
+
+// csvSource is an opened CSV file of the dump. It decompresses the file if
+// necessary.
+type csvSource struct {
+	entry dump.File
+	f     *os.File
+	zr    io.ReadCloser
+}
+
+// Close closes the decompressor and the file.
+func (s *csvSource) Close() error {
+	if s.zr != nil {
+		s.zr.Close()
+	}
+	return s.f.Close()
+}
+
+// openCSV opens the CSV file of a dumped table. The file name comes from the
+// manifest, compression is detected from the file extension and the data is
+// decompressed while it is streamed.
+func (b *buildio) openCSV(table string) (*csv.Reader, *csvSource, error) {
+	m, err := b.manifest()
+	if err != nil {
+		return nil, nil, err
+	}
+	entry, ok := m.File(table)
+	if !ok {
+		return nil, nil, fmt.Errorf("manifest has no file for table '%s'", table)
+	}
+
+	path := filepath.Join(b.cfg.DumpDir, entry.Name)
+	f, err := os.Open(path)
+	if err != nil {
+		slog.Error("Cannot open csv file", "file", entry.Name, "error", err)
+		return nil, nil, err
+	}
+
+	res := &csvSource{entry: entry, f: f}
+	var r io.Reader = f
+	switch dump.CompressionFromName(entry.Name) {
+	case dump.Gzip:
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		res.zr, r = gr, gr
+	case dump.Zstd:
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		res.zr, r = zr.IOReadCloser(), zr
+	}
+	return csv.NewReader(r), res, nil
+}
+
+// readFunc sends rows to a pipeline by calling emit.
+type readFunc func(ctx context.Context, emit func([]string) error) error
+
+// readCSV returns a readFunc that sends rows of the CSV file of a dumped
+// table. If keep is given, rows are sent only if keep returns true. When
+// the file is read to the end, the number of its rows is compared with the
+// manifest.
+func (b *buildio) readCSV(table string, keep func(row []string) bool) readFunc {
+	return func(ctx context.Context, emit func([]string) error) error {
+		r, f, err := b.openCSV(table)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		// skip header
+		if _, err = r.Read(); err != nil {
+			slog.Error("Cannot read csv header", "table", table, "error", err)
+			return err
+		}
+		var rows int64
+		for {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			row, err := r.Read()
+			if err == io.EOF {
+				if rows != f.entry.Rows {
+					return fmt.Errorf("%s has %d rows, manifest expects %d",
+						f.entry.Name, rows, f.entry.Rows)
+				}
+				return nil
+			}
+			if err != nil {
+				slog.Error("Cannot read csv line", "table", table, "error", err)
+				return err
+			}
+			rows++
+			if keep != nil && !keep(row) {
+				continue
+			}
+			if err = emit(row); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// keepSource returns a filter of rows that belong to data-sources of the
+// rebuild. The field is the position of the data-source ID in a row.
+func (b *buildio) keepSource(field int) func(row []string) bool {
+	if !b.isIncremental() {
+		return nil
+	}
+	return func(row []string) bool {
+		return b.hasSource(row[field])
+	}
+}
@@ -0,0 +1,213 @@
+package buildio
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gnames/gnidump/internal/ent/dump"
+	"github.com/gnames/gnsys"
+	"github.com/klauspost/compress/zstd"
+)
+
+// tableSize is an approximate number of rows in a table.
+type tableSize struct {
+	name string
+
+	// rows is the estimate of the number of rows from statistics of the
+	// table. It is -1 if the table was never analyzed.
+	rows int64
+
+	// empty is true if the table has no rows.
+	empty bool
+}
+
+// label describes the size of the table for the user.
+func (t tableSize) label() string {
+	switch {
+	case t.empty:
+		return "empty"
+	case t.rows < 0:
+		return "not analyzed"
+	default:
+		return "~" + humanize.Comma(t.rows)
+	}
+}
+
+// schemaTables returns tables of the schema with their approximate sizes.
+// Row estimates are zero for tables that were never analyzed, so emptiness
+// of tables is checked directly.
+func (b *buildio) schemaTables(ctx context.Context) ([]tableSize, error) {
+	q := `
+SELECT c.relname, c.reltuples::bigint
+	FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE n.nspname = $1 AND c.relkind = 'r'
+	ORDER BY c.relname`
+	rows, err := b.db.Query(ctx, q, schema(b.cfg))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []tableSize
+	for rows.Next() {
+		var ts tableSize
+		if err = rows.Scan(&ts.name, &ts.rows); err != nil {
+			return nil, err
+		}
+		res = append(res, ts)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sch := schema(b.cfg)
+	for i := range res {
+		q = fmt.Sprintf(
+			"SELECT NOT EXISTS (SELECT 1 FROM %s.%s)", sch, res[i].name,
+		)
+		if err = b.db.QueryRow(ctx, q).Scan(&res[i].empty); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// isEmptySchema checks if none of the tables have rows.
+func isEmptySchema(tables []tableSize) bool {
+	for _, v := range tables {
+		if !v.empty {
+			return false
+		}
+	}
+	return true
+}
+
+// confirmReset shows what is going to be destroyed and asks the user to
+// confirm it by typing the name of the database. Without a terminal the
+// reset requires Force setting. Schemas without data are reset without
+// questions.
+func (b *buildio) confirmReset(tables []tableSize) error {
+	if isEmptySchema(tables) {
+		return nil
+	}
+
+	sch := schema(b.cfg)
+	fmt.Fprintf(os.Stderr,
+		"\nSchema '%s' of database '%s' on host '%s' will be DESTROYED.\n",
+		sch, b.cfg.PgDB, b.cfg.PgHost,
+	)
+	fmt.Fprintln(os.Stderr, "It contains tables (estimated number of rows):")
+	for _, v := range tables {
+		fmt.Fprintf(os.Stderr, "  %-30s %15s\n", v.name, v.label())
+	}
+	fmt.Fprintln(os.Stderr, "The verification view is destroyed as well. "+
+		"It is NOT included in backups,\nrecreate it with "+
+		"'gnidump rebuild --steps verification' after tables are restored.")
+	fmt.Fprintln(os.Stderr)
+
+	if b.cfg.Force {
+		slog.Warn("Resetting database without confirmation",
+			"host", b.cfg.PgHost, "database", b.cfg.PgDB, "schema", sch)
+		return nil
+	}
+
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf(
+			"refusing to reset database '%s' without a terminal, use --force flag",
+			b.cfg.PgDB,
+		)
+	}
+
+	fmt.Fprintf(os.Stderr, "Type the database name to continue: ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if strings.TrimSpace(answer) != b.cfg.PgDB {
+		return fmt.Errorf("reset of database '%s' is cancelled", b.cfg.PgDB)
+	}
+	return nil
+}
+
+// backupTables saves tables of the schema to compressed files made by
+// COPY command. The files are saved to a new directory in InputDir and
+// can be loaded back with 'COPY table FROM'. The verification view is not
+// saved, it is recreated from the tables.
+func (b *buildio) backupTables(ctx context.Context, tables []tableSize) error {
+	compression := b.cfg.Compression
+	if compression == dump.NoCompression {
+		compression = dump.Zstd
+	}
+	ext, err := dump.CompressionExt(compression)
+	if err != nil {
+		return err
+	}
+
+	sch := schema(b.cfg)
+	dir := filepath.Join(
+		b.cfg.InputDir,
+		fmt.Sprintf("backup-%s-%s", sch, time.Now().Format("20060102-150405")),
+	)
+	if err = gnsys.MakeDir(dir); err != nil {
+		return err
+	}
+
+	slog.Info("Saving backup of tables", "dir", dir)
+	for _, v := range tables {
+		path := filepath.Join(dir, v.name+".copy"+ext)
+		if err = b.backupTable(ctx, sch, v.name, path); err != nil {
+			slog.Error("Cannot backup table", "table", v.name, "error", err)
+			return err
+		}
+		slog.Info("Saved table", "table", v.name, "file", filepath.Base(path))
+	}
+	return nil
+}
+
+// backupTable copies one table to a compressed file.
+func (b *buildio) backupTable(ctx context.Context, sch, tbl, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var zw io.WriteCloser
+	switch dump.CompressionFromName(path) {
+	case dump.Gzip:
+		zw = gzip.NewWriter(f)
+	case dump.Zstd:
+		if zw, err = zstd.NewWriter(f); err != nil {
+			return err
+		}
+	}
+
+	conn, err := b.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	q := fmt.Sprintf("COPY %s.%s TO STDOUT", sch, tbl)
+	if _, err = conn.Conn().PgConn().CopyTo(ctx, zw, q); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,194 @@
+package buildio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/gnames/gnfmt"
+	"github.com/gnames/gnidump/internal/ent/kv"
+	"github.com/gnames/gnidump/pkg/ent/model"
+	"github.com/gnames/gnparser"
+)
+
+// kvStampKey is the key of the stamp in a key-value store. It cannot clash
+// with IDs of GNI records, because they are numbers.
+var kvStampKey = []byte("gnidump:stamp")
+
+// kvStamp describes the dump file a key-value store was created from.
+// A store is reused by later rebuilds if its stamp matches the dump.
+type kvStamp struct {
+	Store         string `json:"store"`
+	Table         string `json:"table"`
+	SHA256        string `json:"sha256"`
+	ParserVersion string `json:"parserVersion,omitempty"`
+
+	// Sources are sorted IDs of data-sources if the store was filled only
+	// with records of these data-sources. Such store cannot be used by a
+	// full rebuild.
+	Sources []int `json:"sources,omitempty"`
+}
+
+// newKVStamp creates the stamp of a key-value store for the table of the
+// current dump. Sources are given if the store contains only records of
+// these data-sources.
+func (b *buildio) newKVStamp(table string, sources []int) ([]byte, error) {
+	m, err := b.manifest()
+	if err != nil {
+		return nil, err
+	}
+	f, ok := m.File(table)
+	if !ok {
+		return nil, fmt.Errorf("manifest has no file for table '%s'", table)
+	}
+	st := kvStamp{
+		Store:   b.cfg.KVStore,
+		Table:   table,
+		SHA256:  f.SHA256,
+		Sources: sources,
+	}
+	if table == "name_strings" {
+		st.ParserVersion = gnparser.Version
+	}
+	enc := gnfmt.GNjson{}
+	return enc.Encode(st)
+}
+
+// isKVCurrent checks if the key-value store was created from the table of
+// the current dump. A full store is current for any rebuild, a store of
+// some data-sources only for a per-source rebuild of the same data-sources.
+// It is always false if FreshKV is set.
+func (b *buildio) isKVCurrent(store kv.KeyVal, table string) (bool, error) {
+	if b.cfg.FreshKV {
+		return false, nil
+	}
+	saved, err := store.GetValue(kvStampKey)
+	if err != nil {
+		return false, err
+	}
+	st, err := b.newKVStamp(table, nil)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(st, saved) || !b.isIncremental() {
+		return bytes.Equal(st, saved), nil
+	}
+	st, err = b.newKVStamp(table, b.cfg.Sources)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(st, saved), nil
+}
+
+// saveKVStamp marks the key-value store as created from the table of the
+// current dump. Sources are given if the store was filled only with
+// records of these data-sources.
+func (b *buildio) saveKVStamp(
+	store kv.KeyVal,
+	table string,
+	sources []int,
+) error {
+	st, err := b.newKVStamp(table, sources)
+	if err != nil {
+		return err
+	}
+	batch, err := store.NewBatch()
+	if err != nil {
+		return err
+	}
+	if err = batch.Set(kvStampKey, st); err != nil {
+		return err
+	}
+	return batch.Commit()
+}
+
+// prepareSciKV makes sure that the open key-value store of name-strings
+// matches the dump. If it does not, the store is filled again from
+// name_strings file without touching the database. The file is verified
+// first, because the stage that imports it might not be a part of the run.
+func (b *buildio) prepareSciKV(ctx context.Context) error {
+	ok, err := b.isKVCurrent(b.kvSci, "name_strings")
+	if err != nil {
+		return err
+	}
+	if ok {
+		slog.Info("Reusing key-value store of name-strings")
+		return nil
+	}
+
+	slog.Info("Creating key-value store of name-strings")
+	if err = b.verifyTable("name_strings"); err != nil {
+		return err
+	}
+	if err = b.kvSci.Reset(); err != nil {
+		return err
+	}
+
+	var ids map[string]struct{}
+	if b.isIncremental() {
+		if ids, err = b.sourceNameIDs(); err != nil {
+			return err
+		}
+	}
+
+	pl := b.cfg.Pipelines.NameStrings
+	p := pipeline[nameStringsBatch]{
+		name:      "name_strings key-value store",
+		read:      b.readCSV("name_strings", keepNameIDs(ids)),
+		newWorker: b.newNameStringConverter,
+		workers:   pl.Workers,
+		batchSize: b.cfg.BatchSize,
+	}
+	if err = p.run(ctx); err != nil {
+		return err
+	}
+	return b.saveKVStamp(
+		b.kvSci, "name_strings", filteredSources(ids, b.cfg.Sources),
+	)
+}
+
+// prepareVernKV makes sure that the open key-value store of vernacular
+// strings matches the dump. If it does not, the store is filled again from
+// vernacular_strings file without touching the database. The file is
+// verified first, like in prepareSciKV.
+func (b *buildio) prepareVernKV(ctx context.Context) error {
+	ok, err := b.isKVCurrent(b.kvVern, "vernacular_strings")
+	if err != nil {
+		return err
+	}
+	if ok {
+		slog.Info("Reusing key-value store of vernacular strings")
+		return nil
+	}
+
+	slog.Info("Creating key-value store of vernacular strings")
+	if err = b.verifyTable("vernacular_strings"); err != nil {
+		return err
+	}
+	if err = b.kvVern.Reset(); err != nil {
+		return err
+	}
+
+	pl := b.cfg.Pipelines.VernStrings
+	p := pipeline[[]model.VernacularString]{
+		name:      "vernacular_strings key-value store",
+		read:      b.readCSV("vernacular_strings", keepUniqueVern()),
+		newWorker: b.newVernStringConverter,
+		workers:   pl.Workers,
+		batchSize: b.cfg.BatchSize,
+	}
+	if err = p.run(ctx); err != nil {
+		return err
+	}
+	return b.saveKVStamp(b.kvVern, "vernacular_strings", nil)
+}
+
+// filteredSources returns data-sources of the stamp of a name-strings store.
+// They are set only if the store was filled with a subset of name-strings.
+func filteredSources(ids map[string]struct{}, sources []int) []int {
+	if ids == nil {
+		return nil
+	}
+	return sources
+}
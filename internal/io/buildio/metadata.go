@@ -0,0 +1,146 @@
+package buildio
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	gnidump "github.com/gnames/gnidump/pkg"
+	"github.com/gnames/gnparser"
+)
+
+// Keys of build_metadata table.
+const (
+	metaGnidumpVersion = "gnidump_version"
+	metaParserVersion  = "gnparser_version"
+	metaNamesParsedAt  = "names_parsed_at"
+)
+
+// initParserVersion adds the parser_version column and build_metadata table
+// to databases created by older versions of gnidump.
+func (b *buildio) initParserVersion(ctx context.Context) error {
+	qs := []string{
+		`ALTER TABLE IF EXISTS name_strings
+	ADD COLUMN IF NOT EXISTS parser_version VARCHAR(50)`,
+		`CREATE TABLE IF NOT EXISTS build_metadata (
+	key VARCHAR(50) PRIMARY KEY,
+	value VARCHAR(255),
+	updated_at TIMESTAMP WITHOUT TIME ZONE
+)`,
+	}
+	for _, q := range qs {
+		if _, err := b.db.Exec(ctx, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasParserVersion checks if name_strings table of the current schema has
+// the parser_version column. It does not change the database, so it is
+// used in dry-run mode instead of initParserVersion.
+func (b *buildio) hasParserVersion(ctx context.Context) (bool, error) {
+	var res bool
+	q := `
+SELECT EXISTS (
+	SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'name_strings'
+			AND column_name = 'parser_version'
+)`
+	err := b.db.QueryRow(ctx, q).Scan(&res)
+	return res, err
+}
+
+// saveMetadata saves properties of the build.
+func (b *buildio) saveMetadata(ctx context.Context, kv map[string]string) error {
+	q := `
+INSERT INTO build_metadata (key, value, updated_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (key) DO UPDATE
+		SET value = EXCLUDED.value, updated_at = EXCLUDED.updated_at`
+	now := time.Now().UTC()
+	for k, v := range kv {
+		if _, err := b.db.Exec(ctx, q, k, v, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveParserMetadata records that all name-strings were parsed by the
+// current version of gnparser.
+func (b *buildio) saveParserMetadata(ctx context.Context) error {
+	return b.saveMetadata(ctx, map[string]string{
+		metaGnidumpVersion: gnidump.Version,
+		metaParserVersion:  gnparser.Version,
+		metaNamesParsedAt:  time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// isReparseFiltered is true when reparse is limited to some name-strings.
+func (b *buildio) isReparseFiltered() bool {
+	return b.cfg.ReparseOlderThan != "" || len(b.cfg.Sources) > 0 ||
+		len(b.cfg.ParseQualities) > 0
+}
+
+// reparseFilter returns a condition for name_strings table (aliased as ns)
+// that selects name-strings for reparse, and arguments of the condition.
+// Arguments are numbered starting from the given one.
+func (b *buildio) reparseFilter(argNum int) (string, []any, error) {
+	var conds []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(argNum+len(args)-1)
+	}
+
+	if b.cfg.ReparseOlderThan != "" {
+		ver, err := parseVersion(b.cfg.ReparseOlderThan)
+		if err != nil {
+			return "", nil, err
+		}
+		// without the column all versions are NULL and every name matches
+		if !b.noParserVersion {
+			conds = append(conds, fmt.Sprintf(`(ns.parser_version IS NULL OR
+	COALESCE(
+		(regexp_match(ns.parser_version, '(\d+)\.(\d+)\.(\d+)'))::int[] < %s,
+		TRUE
+	))`, arg(ver)))
+		}
+	}
+
+	if len(b.cfg.Sources) > 0 {
+		conds = append(conds, fmt.Sprintf(`EXISTS (
+	SELECT 1 FROM name_string_indices nsi
+		WHERE nsi.name_string_id = ns.id AND nsi.data_source_id = ANY(%s)
+)`, arg(b.cfg.Sources)))
+	}
+
+	if len(b.cfg.ParseQualities) > 0 {
+		conds = append(conds,
+			fmt.Sprintf("ns.parse_quality = ANY(%s)", arg(b.cfg.ParseQualities)))
+	}
+
+	if len(conds) == 0 {
+		return "TRUE", nil, nil
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+var versionRe = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)`)
+
+// parseVersion converts a version like 'v1.11.8' to its numeric parts.
+func parseVersion(s string) ([]int, error) {
+	m := versionRe.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("cannot parse version '%s', use format v1.2.3", s)
+	}
+	res := make([]int, 3)
+	for i := range res {
+		res[i], _ = strconv.Atoi(m[i+1])
+	}
+	return res, nil
+}
@@ -2,20 +2,13 @@ package buildio
 
 import (
 	"context"
-	"encoding/csv"
-	"fmt"
-	"io"
 	"log/slog"
-	"os"
-	"path/filepath"
 	"strconv"
-	"strings"
-	"time"
 
-	"github.com/dustin/go-humanize"
 	"github.com/gnames/gnfmt"
+	"github.com/gnames/gnidump/internal/ent/datasource"
 	"github.com/gnames/gnidump/pkg/ent/model"
-	"golang.org/x/sync/errgroup"
+	"github.com/gnames/gnlib/ent/verifier"
 )
 
 // List of fields from the name-string indices CSV file. The value corresponds
@@ -35,39 +28,54 @@ const (
 )
 
 // importNameIndices import data into name_string_indices table.
-func (b *buildio) importNameIndices() error {
+func (b *buildio) importNameIndices(ctx context.Context) error {
 	slog.Info("Uploading data for name_string_indices table")
 
-	err := b.kvSci.Open()
-	if err != nil {
-		slog.Error("cannot open key-value store", "error", err)
-		return err
-	}
-	defer b.kvSci.Close()
-
-	_ = b.truncateTable("name_string_indices")
-
-	chIn := make(chan []string)
-	chOut := make(chan []model.NameStringIndex)
+	var err error
+	// the sort-merge join does not use the key-value store
+	if !b.cfg.SortJoin {
+		if err = b.kvSci.Open(); err != nil {
+			slog.Error("cannot open key-value store", "error", err)
+			return err
+		}
+		defer b.kvSci.Close()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	g, ctx := errgroup.WithContext(ctx)
+		if err = b.prepareSciKV(ctx); err != nil {
+			slog.Error("Cannot prepare key-value store", "error", err)
+			return err
+		}
+	}
 
-	g.Go(func() error {
-		defer close(chIn)
-		return b.loadNameStringIndices(ctx, chIn)
-	})
-	g.Go(func() error {
-		defer close(chOut)
-		return b.workerNameStringIndex(ctx, chIn, chOut)
-	})
-	g.Go(func() error {
-		return b.dbNameStringIndices(ctx, chOut)
-	})
+	if b.isIncremental() {
+		err = b.deleteSourceIndices(ctx)
+		if err != nil {
+			slog.Error("Cannot delete indices of data-sources", "error", err)
+			return err
+		}
+	} else {
+		_ = b.truncateTable("name_string_indices")
+	}
 
-	if err := g.Wait(); err != nil {
-		slog.Error("error in goroutines", "error", err)
+	pl := b.cfg.Pipelines.NameIndices
+	p := pipeline[[]model.NameStringIndex]{
+		name: "name_string_indices",
+		read: b.readCSV(
+			"name_string_indices", b.keepSource(nsiDataSourceIDF),
+		),
+		newWorker: newConvertFunc(b.convertNameIndices),
+		write: func(_ context.Context, nsi []model.NameStringIndex) (int64, error) {
+			return b.saveNameStringIndices(nsi)
+		},
+		workers:   pl.Workers,
+		writers:   pl.Writers,
+		batchSize: b.cfg.BatchSize,
+		progress:  "Uploaded %s indices, %s names/sec",
+	}
+	if b.cfg.SortJoin {
+		p.read = b.readJoinedNameIndices
+		p.newWorker = newConvertFunc(b.convertJoinedNameIndices)
+	}
+	if err = p.run(ctx); err != nil {
 		return err
 	}
 
@@ -75,69 +83,63 @@ func (b *buildio) importNameIndices() error {
 	return nil
 }
 
-func (b *buildio) dbNameStringIndices(
-	ctx context.Context,
-	chOut <-chan []model.NameStringIndex,
-) error {
-	var err error
-	var saved, total int64
+// convertNameIndices converts a batch of rows to name-string indices.
+// Parsed data of name-strings for the batch is taken from the key-value
+// store by one bulk read.
+func (b *buildio) convertNameIndices(
+	rows [][]string,
+) ([]model.NameStringIndex, error) {
+	enc := gnfmt.GNgob{}
+	keys := make([][]byte, len(rows))
+	for i, row := range rows {
+		keys[i] = []byte(row[nsiNameStringIDF])
+	}
+	vals, err := b.kvSci.GetValues(keys)
+	if err != nil {
+		slog.Error("Cannot get values", "error", err)
+		return nil, err
+	}
 
-	timeStart := time.Now().UnixNano()
-	for nsi := range chOut {
-		saved, err = b.saveNameStringIndices(nsi)
+	res := make([]model.NameStringIndex, len(rows))
+	for i, row := range rows {
+		res[i], err = b.processSciIdxRow(row, vals[i], enc)
 		if err != nil {
-			slog.Error("Cannot save name-string-indices", "error", err)
-			return err
+			return nil, err
 		}
-		total += saved
-		timeSpent := float64(time.Now().UnixNano()-timeStart) / 1_000_000_000
-		speed := int64(float64(total) / timeSpent)
-		fmt.Printf("\r%s", strings.Repeat(" ", 40))
-		fmt.Printf("\rUploaded %s indices, %s names/sec",
-			humanize.Comma(total), humanize.Comma(speed))
-	}
-	fmt.Println()
-	return nil
+	}
+	return res, nil
 }
 
-func (b *buildio) workerNameStringIndex(
-	ctx context.Context,
-	chIn <-chan []string,
-	chOut chan<- []model.NameStringIndex,
-) error {
-	enc := gnfmt.GNgob{}
-	res := make([]model.NameStringIndex, b.cfg.BatchSize)
-	i := 0
-loop:
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case row, ok := <-chIn:
-			if !ok {
-				break loop
-			}
-			dsi, err := b.processSciIdxRow(row, enc)
-			if err != nil {
-				return err
-			}
-
-			if i < b.cfg.BatchSize {
-				res[i] = dsi
-			} else {
-				chOut <- res
-				i = 0
-				res = make([]model.NameStringIndex, b.cfg.BatchSize)
-				res[i] = dsi
-			}
-			i++
-		}
+func (b *buildio) processSciIdxRow(
+	row []string,
+	parsedBytes []byte,
+	enc gnfmt.GNgob,
+) (model.NameStringIndex, error) {
+	var parsed parsedData
+	if parsedBytes == nil {
+		warnNoNameString(row)
 	}
-	chOut <- res[0:i]
-	return nil
+	err := enc.Decode(parsedBytes, &parsed)
+	if err != nil {
+		slog.Error("Cannot decode parsed data", "error", err)
+		return model.NameStringIndex{}, err
+	}
+	return b.nameStringIndex(row, parsed)
 }
 
-func (b *buildio) processSciIdxRow(row []string, enc gnfmt.GNgob) (model.NameStringIndex, error) {
+func warnNoNameString(row []string) {
+	slog.Warn("Cannot find key", "key", row[nsiNameStringIDF],
+		"data-source", row[nsiDataSourceIDF],
+		"record", row[nsiTaxonIDF],
+	)
+}
+
+// nameStringIndex creates a name-string index from a row of the dump and
+// parsed data of its name-string.
+func (b *buildio) nameStringIndex(
+	row []string,
+	parsed parsedData,
+) (model.NameStringIndex, error) {
 	var dsi model.NameStringIndex
 	dsID, err := strconv.Atoi(row[nsiDataSourceIDF])
 	if err != nil {
@@ -148,21 +150,6 @@ func (b *buildio) processSciIdxRow(row []string, enc gnfmt.GNgob) (model.NameStr
 	if err != nil {
 		codeID = 0
 	}
-	var parsed parsedData
-	parsedBytes, err := b.kvSci.GetValue([]byte(row[nsiNameStringIDF]))
-	if err != nil {
-		slog.Error("Cannot get Value", "error", err,
-			"data-source", row[nsiDataSourceIDF],
-			"record", row[nsIDF],
-		)
-		// was continue
-		return dsi, err
-	}
-	err = enc.Decode(parsedBytes, &parsed)
-	if err != nil {
-		slog.Error("Cannot decode parsed data", "error", err)
-		return dsi, err
-	}
 	dsi = model.NameStringIndex{
 		DataSourceID:        dsID,
 		NameStringID:        parsed.ID,
@@ -176,7 +163,9 @@ func (b *buildio) processSciIdxRow(row []string, enc gnfmt.GNgob) (model.NameStr
 		ClassificationIDs:   row[nsiClassificationIDsF],
 		ClassificationRanks: row[nsiClassificationRanksF],
 	}
-	nInf := NameInf{
+	dsi.TaxonomicStatus = taxonomicStatus(dsi)
+
+	rec := datasource.Record{
 		RecordID:         dsi.RecordID,
 		AcceptedRecordID: dsi.AcceptedRecordID,
 		LocalID:          dsi.LocalID,
@@ -184,45 +173,30 @@ func (b *buildio) processSciIdxRow(row []string, enc gnfmt.GNgob) (model.NameStr
 		Canonical:        parsed.CanonicalSimple,
 		CanonicalFull:    parsed.CanonicalFull,
 	}
-	if dInf, ok := DataSourcesInf[dsID]; ok && dInf.OutlinkID != nil {
-		dsi.OutlinkID = dInf.OutlinkID(nInf)
+	info := b.registry[dsID]
+	if info.NameID != nil {
+		dsi.NameID = info.NameID.ID(rec)
+		rec.NameID = dsi.NameID
+	}
+	if info.OutlinkID != nil {
+		dsi.OutlinkID = info.OutlinkID.ID(rec)
 	}
 	return dsi, nil
 }
 
-func (b *buildio) loadNameStringIndices(
-	ctx context.Context,
-	chIn chan<- []string,
-) error {
-	path := filepath.Join(b.cfg.DumpDir, "name_string_indices.csv")
-	f, err := os.Open(path)
-	if err != nil {
-		slog.Error("Cannot open name_string_indices.csv", "error", err)
-		return err
-	}
-	defer f.Close()
-	r := csv.NewReader(f)
-
-	// skip header
-	_, err = r.Read()
-	if err != nil {
-		slog.Error("Cannot read csv header", "error", err)
-		return err
-	}
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			row, err := r.Read()
-			if err == io.EOF {
-				return nil
-			}
-			if err != nil {
-				slog.Error("Cannot read csv line", "error", err)
-				return err
-			}
-			chIn <- row
-		}
+// taxonomicStatus normalizes the status of a record to string values of
+// gnlib verifier.TaxonomicStatus. Records without accepted record ID and
+// classification are bare names. Gnlib has no bare-name status, so they
+// get the unknown status ("N/A"), which is what gnverifier clients expect
+// for names without taxonomic data. Other records are accepted, unless
+// their accepted record ID points to another record.
+func taxonomicStatus(dsi model.NameStringIndex) string {
+	switch {
+	case dsi.AcceptedRecordID == "" && dsi.Classification == "":
+		return verifier.UnknownTaxStatus.String()
+	case dsi.AcceptedRecordID == "" || dsi.AcceptedRecordID == dsi.RecordID:
+		return verifier.AcceptedTaxStatus.String()
+	default:
+		return verifier.SynonymTaxStatus.String()
 	}
 }
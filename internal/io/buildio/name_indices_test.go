@@ -0,0 +1,35 @@
+package buildio
+
+import (
+	"testing"
+
+	"github.com/gnames/gnidump/pkg/ent/model"
+)
+
+func TestTaxonomicStatus(t *testing.T) {
+	tests := []struct {
+		msg                     string
+		record, accepted, class string
+		want                    string
+	}{
+		{"bare name", "1", "", "", "N/A"},
+		{"bare name without record", "", "", "", "N/A"},
+		{"no accepted, classification", "1", "", "Plantae|Aus", "Accepted"},
+		{"accepted is record", "1", "1", "", "Accepted"},
+		{"accepted with classification", "1", "1", "Plantae|Aus", "Accepted"},
+		{"synonym", "2", "1", "", "Synonym"},
+		{"synonym with classification", "2", "1", "Plantae|Aus", "Synonym"},
+		{"accepted without record", "", "1", "", "Synonym"},
+	}
+
+	for _, v := range tests {
+		dsi := model.NameStringIndex{
+			RecordID:         v.record,
+			AcceptedRecordID: v.accepted,
+			Classification:   v.class,
+		}
+		if res := taxonomicStatus(dsi); res != v.want {
+			t.Errorf("%s: got '%s', want '%s'", v.msg, res, v.want)
+		}
+	}
+}
@@ -3,25 +3,16 @@ package buildio
 import (
 	"context"
 	"database/sql"
-	"encoding/csv"
-	"fmt"
-	"io"
 	"log/slog"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
 
-	"github.com/dgraph-io/badger/v2"
-	"github.com/dustin/go-humanize"
 	"github.com/gnames/gnfmt"
+	"github.com/gnames/gnidump/internal/ent/kv"
 	"github.com/gnames/gnidump/pkg/ent/model"
 	"github.com/gnames/gnparser"
 	"github.com/gnames/gnparser/ent/parsed"
 	"github.com/gnames/gnuuid"
-	"golang.org/x/sync/errgroup"
 )
 
 const (
@@ -47,7 +38,7 @@ type parsedData struct {
 	CanonicalFull   string
 }
 
-func (b *buildio) importNameStrings() error {
+func (b *buildio) importNameStrings(ctx context.Context) error {
 	slog.Info("Importing name-strings")
 
 	err := b.kvSci.Open()
@@ -57,140 +48,132 @@ func (b *buildio) importNameStrings() error {
 	}
 	defer b.kvSci.Close()
 
-	_ = b.truncateTable("name_strings", "canonicals", "canonical_fulls", "canonical_stems")
-
-	chIn := make(chan []string)
-	chCan := make(chan []canonicalData)
-	chOut := make(chan []model.NameString)
-	var wg sync.WaitGroup
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	g, ctx := errgroup.WithContext(ctx)
+	// the store is filled again from the dump
+	if err = b.kvSci.Reset(); err != nil {
+		slog.Error("Cannot reset key-value store", "error", err)
+		return err
+	}
 
-	g.Go(func() error {
-		defer close(chIn)
-		return b.loadNameStrings(ctx, chIn)
-	})
-	for i := 0; i < b.cfg.JobsNum; i++ {
-		wg.Add(1)
-		g.Go(func() error {
-			defer wg.Done()
-			return b.workerNameString(ctx, chIn, chCan, chOut)
-		})
+	var ids map[string]struct{}
+	if b.isIncremental() {
+		if ids, err = b.sourceNameIDs(); err != nil {
+			return err
+		}
+	} else {
+		_ = b.truncateTable("name_strings", "canonicals", "canonical_fulls", "canonical_stems")
 	}
-	g.Go(func() error {
-		return b.dbNameString(ctx, chOut, chCan)
-	})
 
-	go func() {
-		wg.Wait()
-		close(chOut)
-		close(chCan)
-	}()
+	pl := b.cfg.Pipelines.NameStrings
+	p := pipeline[nameStringsBatch]{
+		name:      "name_strings",
+		read:      b.readCSV("name_strings", keepNameIDs(ids)),
+		newWorker: b.newNameStringConverter,
+		write:     b.writeNameStrings,
+		workers:   pl.Workers,
+		writers:   pl.Writers,
+		batchSize: b.cfg.BatchSize,
+		progress:  "Uploaded %s names, %s names/sec",
+	}
+	if err = p.run(ctx); err != nil {
+		return err
+	}
 
-	if err := g.Wait(); err != nil {
-		slog.Error("error in goroutines", "error", err)
+	if err = b.saveKVStamp(
+		b.kvSci, "name_strings", filteredSources(ids, b.cfg.Sources),
+	); err != nil {
+		slog.Error("Cannot save key-value store stamp", "error", err)
 		return err
 	}
 
+	if !b.isIncremental() {
+		if err = b.saveParserMetadata(ctx); err != nil {
+			slog.Error("Cannot save build metadata", "error", err)
+			return err
+		}
+	}
+
 	slog.Info("Uploaded name_strings table")
 	return nil
 }
 
-func (b *buildio) loadNameStrings(ctx context.Context, chIn chan<- []string) error {
-	r, f, err := b.openCSV("name_strings.csv")
-	if err != nil {
-		return err
+// keepNameIDs returns a filter of name-strings with the given IDs. If ids
+// are nil, all name-strings are kept.
+func keepNameIDs(ids map[string]struct{}) func(row []string) bool {
+	if ids == nil {
+		return nil
 	}
-	defer f.Close()
-
-	// skip header
-	_, err = r.Read()
-	if err != nil {
-		slog.Error("cannot read the header name_strings", "error", err)
-		return err
+	return func(row []string) bool {
+		_, ok := ids[row[nsIDF]]
+		return ok
 	}
-loop:
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			row, err := r.Read()
-			if err == io.EOF {
-				break loop
-			}
-			if err != nil {
-				slog.Error("cannot read name_strings.csv", "error", err)
-				return err
-			}
-			chIn <- row
-		}
-	}
-	return nil
 }
 
-// workerNameString parses name-strings and prepares for the database.
-func (b *buildio) workerNameString(
-	ctx context.Context,
-	chIn <-chan []string,
-	chCan chan<- []canonicalData,
-	chOut chan<- []model.NameString,
-) error {
-	var err error
+// nameStringsBatch contains name-strings and their canonical forms
+// converted from a batch of rows.
+type nameStringsBatch struct {
+	names []model.NameString
+	cans  []canonicalData
+}
+
+// nameStringConverter parses name-strings and saves their parsed data to
+// the key-value store.
+type nameStringConverter struct {
+	b       *buildio
+	gnp     gnparser.GNparser
+	enc     gnfmt.Encoder
+	kvBatch kv.Batch
+}
 
-	kvTxn, err := b.kvSci.GetTransaction()
+func (b *buildio) newNameStringConverter() (converter[nameStringsBatch], error) {
+	kvBatch, err := b.kvSci.NewBatch()
 	if err != nil {
-		slog.Error("cannot make key-val transaction", "error", err)
-		return err
+		slog.Error("cannot make key-val batch", "error", err)
+		return nil, err
 	}
+	res := nameStringConverter{
+		b:       b,
+		gnp:     gnparser.New(gnparser.NewConfig()),
+		enc:     gnfmt.GNgob{},
+		kvBatch: kvBatch,
+	}
+	return &res, nil
+}
 
-	enc := gnfmt.GNgob{}
-	gnp := gnparser.New(gnparser.NewConfig())
-
-	res := make([]model.NameString, b.cfg.BatchSize)
-	cans := make([]canonicalData, 0, b.cfg.BatchSize)
-	i := 0
-loop:
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case row, ok := <-chIn:
-			if !ok {
-				break loop
-			}
-			var p parsed.Parsed
-			p, kvTxn, err = b.saveNameKV(gnp, enc, row, kvTxn)
-			if err != nil {
-				return err
-			}
-			var n model.NameString
-			cans, n = b.prepareCansAndName(p, cans)
-
-			if i < b.cfg.BatchSize {
-				res[i] = n
-			} else {
-				chOut <- res
-				chCan <- cans
-				i = 0
-				res = make([]model.NameString, b.cfg.BatchSize)
-				cans = make([]canonicalData, 0, b.cfg.BatchSize)
-				res[i] = n
-			}
-			i++
+func (c *nameStringConverter) convert(rows [][]string) (nameStringsBatch, error) {
+	res := nameStringsBatch{
+		names: make([]model.NameString, len(rows)),
+		cans:  make([]canonicalData, 0, len(rows)),
+	}
+	for i, row := range rows {
+		p, err := c.b.saveNameKV(c.gnp, c.enc, row, c.kvBatch)
+		if err != nil {
+			return res, err
 		}
+		res.cans, res.names[i] = c.b.prepareCansAndName(p, res.cans)
 	}
-	err = kvTxn.Commit()
+	return res, nil
+}
+
+func (c *nameStringConverter) close() error {
+	err := c.kvBatch.Commit()
 	if err != nil {
-		slog.Error("cannot commit key/value transaction", "error", err)
-		return err
+		slog.Error("cannot commit key/value batch", "error", err)
 	}
+	return err
+}
 
-	chOut <- res[0:i]
-	chCan <- cans
-	return nil
+// writeNameStrings saves name-strings and their canonical forms to the
+// database.
+func (b *buildio) writeNameStrings(
+	_ context.Context,
+	data nameStringsBatch,
+) (int64, error) {
+	if len(data.cans) > 0 {
+		if err := b.saveCanonicals(data.cans); err != nil {
+			return 0, err
+		}
+	}
+	return b.saveNameStrings(data.names)
 }
 
 func (*buildio) prepareCansAndName(
@@ -264,6 +247,7 @@ func (*buildio) prepareCansAndName(
 		Bacteria:        bacteria,
 		Surrogate:       surrogate,
 		ParseQuality:    int(p.ParseQuality),
+		ParserVersion:   gnparser.Version,
 	}
 	return cans, n
 }
@@ -272,95 +256,33 @@ func (b *buildio) saveNameKV(
 	gnp gnparser.GNparser,
 	enc gnfmt.Encoder,
 	row []string,
-	kvTxn *badger.Txn,
-) (parsed.Parsed, *badger.Txn, error) {
-	var err error
-	var valBytes []byte
+	kvBatch kv.Batch,
+) (parsed.Parsed, error) {
 	id := row[nsIDF]
 	p := gnp.ParseName(row[nsNameF])
 	key := id
+	val := newParsedData(p)
 
-	var can, canf string
-	if p.Parsed {
-		can = p.Canonical.Simple
-		canf = p.Canonical.Full
-	}
-	val := parsedData{
-		ID:              p.VerbatimID,
-		CanonicalSimple: can,
-		CanonicalFull:   canf,
-	}
-
-	valBytes, err = enc.Encode(val)
+	valBytes, err := enc.Encode(val)
 	if err != nil {
 		slog.Error("cannot encode parsed data", "error", err)
-		return p, nil, err
+		return p, err
 	}
-	if err = kvTxn.Set([]byte(key), []byte(valBytes)); err == badger.ErrTxnTooBig {
-		err = kvTxn.Commit()
-		if err != nil {
-			slog.Error("cannot commit key/value transaction", "error", err)
-			return p, nil, err
-		}
-		kvTxn, err = b.kvSci.GetTransaction()
-		if err != nil {
-			slog.Error("cannot recreate key-val transaction", "error", err)
-			return p, nil, err
-		}
-		err = kvTxn.Set([]byte(key), []byte(valBytes))
-		if err != nil {
-			slog.Error("cannot set key/value", "error", err)
-			return p, nil, err
-		}
-
+	if err = kvBatch.Set([]byte(key), valBytes); err != nil {
+		slog.Error("cannot set key/value", "error", err)
+		return p, err
 	}
-	return p, kvTxn, nil
+	return p, nil
 }
 
-func (b *buildio) dbNameString(
-	ctx context.Context,
-	chOut <-chan []model.NameString,
-	chCan <-chan []canonicalData,
-) error {
-	var err error
-	var saved, total int64
-	timeStart := time.Now().UnixNano()
-loop:
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case ns, ok := <-chOut:
-			if !ok {
-				chOut = nil
-			}
-			saved, err = b.saveNameStrings(ns)
-			if err != nil {
-				return err
-			}
-			total += saved
-			timeSpent := float64(time.Now().UnixNano()-timeStart) / 1_000_000_000
-			speed := int64(float64(total) / timeSpent)
-			fmt.Printf("\r%s", strings.Repeat(" ", 40))
-			fmt.Printf("\rUploaded %s names, %s names/sec",
-				humanize.Comma(total), humanize.Comma(speed))
-		case cs, ok := <-chCan:
-			if len(cs) > 0 {
-				err = b.saveCanonicals(cs)
-				if err != nil {
-					return err
-				}
-			}
-			if !ok {
-				chCan = nil
-			}
-		}
-		if chOut == nil && chCan == nil {
-			break loop
-		}
+// newParsedData keeps data of a parsed name-string needed for indices.
+func newParsedData(p parsed.Parsed) parsedData {
+	res := parsedData{ID: p.VerbatimID}
+	if p.Parsed {
+		res.CanonicalSimple = p.Canonical.Simple
+		res.CanonicalFull = p.Canonical.Full
 	}
-	fmt.Println()
-	return nil
+	return res
 }
 
 func parseYear(p parsed.Parsed) sql.NullInt16 {
@@ -375,14 +297,3 @@ func parseYear(p parsed.Parsed) sql.NullInt16 {
 	}
 	return sql.NullInt16{Int16: int16(yrInt), Valid: true}
 }
-
-func (b *buildio) openCSV(fileName string) (*csv.Reader, *os.File, error) {
-	path := filepath.Join(b.cfg.DumpDir, fileName)
-	f, err := os.Open(path)
-	if err != nil {
-		slog.Error("Cannot open csv file", "error", err)
-		return nil, nil, err
-	}
-	r := csv.NewReader(f)
-	return r, f, nil
-}
@@ -0,0 +1,232 @@
+package buildio
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gnames/gnidump/internal/ent/datasource"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// outlinkChange is a name-string index record with a new name ID and a new
+// outlink ID. The row is identified by its physical location (ctid),
+// because name_string_indices has no primary key.
+type outlinkChange struct {
+	ctid         pgtype.TID
+	rec          datasource.Record
+	nameStringID string
+	nameID       string
+	outlinkID    string
+}
+
+// UpdateOutlinks recomputes name IDs and outlink IDs of name-string indices
+// from the stored records using rules of the data-sources registry. It also
+// updates outlink URLs of data-sources. If Sources are not set, all
+// data-sources of the database are updated. The verification view is
+// refreshed if any outlink changed.
+func (b *buildio) UpdateOutlinks() error {
+	defer b.db.Close()
+	ctx := context.Background()
+
+	ids := b.cfg.Sources
+	if len(ids) == 0 {
+		var err error
+		if ids, err = b.dataSourceIDs(ctx); err != nil {
+			slog.Error("Cannot get data-sources", "error", err)
+			return err
+		}
+	}
+
+	counts := make([]int64, len(ids))
+	for i, id := range ids {
+		if err := b.updateSourceOutlink(ctx, id); err != nil {
+			slog.Error("Cannot update data-source outlink",
+				"data-source", id, "error", err)
+			return err
+		}
+		count, err := b.updateOutlinkIDs(ctx, id)
+		if err != nil {
+			slog.Error("Cannot update outlink IDs",
+				"data-source", id, "error", err)
+			return err
+		}
+		counts[i] = count
+		slog.Info("Updated outlink IDs",
+			"data-source", id, "records", humanize.Comma(count))
+	}
+
+	var total int64
+	fmt.Fprintf(os.Stderr, "\n%-12s %15s\n", "data-source", "changed rows")
+	for i, id := range ids {
+		fmt.Fprintf(os.Stderr, "%-12d %15s\n", id, humanize.Comma(counts[i]))
+		total += counts[i]
+	}
+	fmt.Fprintf(os.Stderr, "%-12s %15s\n\n", "total", humanize.Comma(total))
+
+	if total == 0 {
+		return nil
+	}
+	return b.refreshVerification()
+}
+
+func (b *buildio) dataSourceIDs(ctx context.Context) ([]int, error) {
+	rows, err := b.db.Query(ctx, "SELECT id FROM data_sources ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// updateSourceOutlink saves the outlink URL template and the readiness
+// flag of a data-source from the registry.
+func (b *buildio) updateSourceOutlink(ctx context.Context, id int) error {
+	info := b.registry[id]
+	q := `
+UPDATE data_sources
+	SET outlink_url = $2, is_outlink_ready = $3
+	WHERE id = $1`
+	tag, err := b.db.Exec(ctx, q, id, info.OutlinkURL, info.IsOutlinkReady)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		slog.Warn("Data-source is not in the database", "data-source", id)
+	}
+	return nil
+}
+
+// updateOutlinkIDs recomputes name IDs and outlink IDs of one data-source
+// the same way as the import of name-string indices. Records with changed
+// IDs are saved in batches. It returns the number of updated rows.
+func (b *buildio) updateOutlinkIDs(ctx context.Context, id int) (int64, error) {
+	info := b.registry[id]
+	q := `
+SELECT
+	nsi.ctid, nsi.name_string_id, COALESCE(nsi.record_id, ''),
+	COALESCE(nsi.accepted_record_id, ''), COALESCE(nsi.local_id, ''),
+	COALESCE(nsi.global_id, ''), COALESCE(nsi.name_id, ''),
+	COALESCE(c.name, ''), COALESCE(cf.name, c.name, ''),
+	COALESCE(nsi.outlink_id, '')
+FROM name_string_indices nsi
+	JOIN name_strings ns ON ns.id = nsi.name_string_id
+	LEFT JOIN canonicals c ON c.id = ns.canonical_id
+	LEFT JOIN canonical_fulls cf ON cf.id = ns.canonical_full_id
+WHERE nsi.data_source_id = $1`
+	rows, err := b.db.Query(ctx, q, id)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var total int64
+	batch := make([]outlinkChange, 0, b.cfg.BatchSize)
+	save := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		count, err := b.saveOutlinkIDs(ctx, id, batch)
+		if err != nil {
+			return err
+		}
+		total += count
+		batch = batch[:0]
+		return nil
+	}
+
+	for rows.Next() {
+		var ch outlinkChange
+		var old string
+		r := &ch.rec
+		err = rows.Scan(
+			&ch.ctid, &ch.nameStringID, &r.RecordID, &r.AcceptedRecordID, &r.LocalID,
+			&r.GlobalID, &r.NameID, &r.Canonical, &r.CanonicalFull, &old,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		rec := ch.rec
+		rec.NameID = ""
+		if info.NameID != nil {
+			rec.NameID = info.NameID.ID(rec)
+		}
+		ch.nameID = rec.NameID
+		if info.OutlinkID != nil {
+			ch.outlinkID = info.OutlinkID.ID(rec)
+		}
+		if ch.nameID == r.NameID && ch.outlinkID == old {
+			continue
+		}
+		batch = append(batch, ch)
+		if len(batch) == b.cfg.BatchSize {
+			if err = save(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if err = save(); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// saveOutlinkIDs updates name IDs and outlink IDs of a batch of records.
+// Records are matched by their ctid. Rows of the batch were read by a query
+// that is still open, so its snapshot keeps vacuum from reusing their ctids,
+// and every row is updated only once.
+func (b *buildio) saveOutlinkIDs(
+	ctx context.Context,
+	id int,
+	batch []outlinkChange,
+) (int64, error) {
+	columns := []string{"row_id", "name_string_id", "name_id", "outlink_id"}
+	rows := make([][]any, len(batch))
+	for i, v := range batch {
+		rows[i] = []any{v.ctid, v.nameStringID, v.nameID, v.outlinkID}
+	}
+
+	var res int64
+	err := pgx.BeginFunc(ctx, b.db, func(tx pgx.Tx) error {
+		q := `
+CREATE TEMP TABLE outlink_batch (
+	row_id TID,
+	name_string_id UUID,
+	name_id VARCHAR(255),
+	outlink_id VARCHAR(255)
+) ON COMMIT DROP`
+		if _, err := tx.Exec(ctx, q); err != nil {
+			return err
+		}
+		_, err := tx.CopyFrom(ctx, pgx.Identifier{"outlink_batch"}, columns,
+			pgx.CopyFromRows(rows))
+		if err != nil {
+			return err
+		}
+
+		q = `
+UPDATE name_string_indices nsi
+	SET name_id = o.name_id, outlink_id = o.outlink_id
+	FROM outlink_batch o
+	WHERE nsi.ctid = o.row_id
+		AND nsi.data_source_id = $1
+		AND nsi.name_string_id = o.name_string_id
+		AND (
+			COALESCE(nsi.outlink_id, '') <> o.outlink_id OR
+			COALESCE(nsi.name_id, '') <> o.name_id
+		)`
+		tag, err := tx.Exec(ctx, q, id)
+		if err != nil {
+			return err
+		}
+		res = tag.RowsAffected()
+		return nil
+	})
+	return res, err
+}
@@ -0,0 +1,310 @@
+package buildio
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/dustin/go-humanize"
+	"github.com/jackc/pgx/v5"
+)
+
+// outlinkCheck contains results of the outlinks check of a data-source.
+type outlinkCheck struct {
+	id         int
+	titleShort string
+	outlinkURL string
+	isReady    bool
+
+	// records is the number of sampled records.
+	records int
+
+	// emptyIDs is the number of records without an outlink ID.
+	emptyIDs int
+
+	// unescaped is the number of records with characters that are not
+	// allowed in URLs.
+	unescaped int
+
+	// duplicates is the number of records with more than one outlink.
+	duplicates int
+
+	// example is a URL of a failed record.
+	example string
+}
+
+// problems lists reasons why the data-source failed the check.
+func (c outlinkCheck) problems() []string {
+	var res []string
+	switch {
+	case c.outlinkURL == "":
+		res = append(res, "no template")
+	case !strings.Contains(c.outlinkURL, "{}"):
+		res = append(res, "no {} in template")
+	}
+	if c.records == 0 {
+		res = append(res, "no records")
+	}
+	if c.emptyIDs > 0 {
+		res = append(res, "empty IDs")
+	}
+	if c.unescaped > 0 {
+		res = append(res, "unescaped characters")
+	}
+	if c.duplicates > 0 {
+		res = append(res, "duplicate outlinks")
+	}
+	return res
+}
+
+// CheckOutlinks renders outlinks for a sample of records of every
+// data-source and checks that they are well-formed. URLs are not requested,
+// so the check works offline. If Sources are not set, data-sources marked
+// as outlink-ready are checked.
+func (b *buildio) CheckOutlinks() error {
+	defer b.db.Close()
+	ctx := context.Background()
+
+	checks, err := b.outlinkSources(ctx)
+	if err != nil {
+		slog.Error("Cannot get data-sources", "error", err)
+		return err
+	}
+
+	var failed int
+	for i := range checks {
+		if err = b.checkOutlinks(ctx, &checks[i]); err != nil {
+			slog.Error("Cannot check outlinks",
+				"data-source", checks[i].id, "error", err)
+			return err
+		}
+		if len(checks[i].problems()) > 0 {
+			failed++
+		}
+	}
+
+	printOutlinkChecks(checks)
+	if failed > 0 {
+		return fmt.Errorf("outlinks of %d data-sources failed the check", failed)
+	}
+	slog.Info("Outlinks passed the check",
+		"data-sources", humanize.Comma(int64(len(checks))))
+	return nil
+}
+
+func (b *buildio) outlinkSources(ctx context.Context) ([]outlinkCheck, error) {
+	q := `
+SELECT id, title_short, COALESCE(outlink_url, ''), is_outlink_ready
+	FROM data_sources
+	WHERE is_outlink_ready
+	ORDER BY id`
+	var args []any
+	if len(b.cfg.Sources) > 0 {
+		q = `
+SELECT id, title_short, COALESCE(outlink_url, ''), is_outlink_ready
+	FROM data_sources
+	WHERE id = ANY($1)
+	ORDER BY id`
+		args = append(args, b.cfg.Sources)
+	}
+	rows, err := b.db.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (outlinkCheck, error) {
+		var res outlinkCheck
+		err := row.Scan(&res.id, &res.titleShort, &res.outlinkURL, &res.isReady)
+		return res, err
+	})
+}
+
+// fullScanFactor limits the size of data-sources which records are
+// sampled by reading all of them. Records of larger data-sources are taken
+// from a sample of the table blocks.
+const fullScanFactor = 100
+
+// checkOutlinks samples records of a data-source and checks their
+// outlinks.
+func (b *buildio) checkOutlinks(ctx context.Context, c *outlinkCheck) error {
+	recs, err := b.sampleOutlinks(ctx, c.id)
+	if err != nil {
+		return err
+	}
+	c.records = len(recs)
+
+	recordIDs := make([]string, len(recs))
+	for i, v := range recs {
+		recordIDs[i] = v.recordID
+		c.checkRecord(v.outlinkID)
+	}
+
+	dups, err := b.duplicateOutlinks(ctx, c.id, recordIDs)
+	if err != nil {
+		return err
+	}
+	c.duplicates = len(dups)
+	for _, v := range dups {
+		c.addExample(c.render(v))
+	}
+	return nil
+}
+
+// sampledOutlink is an outlink ID of a sampled record.
+type sampledOutlink struct {
+	recordID  string
+	outlinkID string
+}
+
+// sampleOutlinks returns at most OutlinkSampleSize random records of a
+// data-source. Small data-sources are read through the index. For large
+// ones a share of table blocks is read, so the sample of a data-source is
+// about 3 times larger than needed, and is cut by the limit. Records of a
+// data-source are clustered in the table, so sampled blocks might miss
+// most of them. In such case the data-source is read through the index as
+// well.
+func (b *buildio) sampleOutlinks(
+	ctx context.Context,
+	dsID int,
+) ([]sampledOutlink, error) {
+	size := b.cfg.OutlinkSampleSize
+	var records int
+	err := b.db.QueryRow(ctx,
+		"SELECT COALESCE(record_count, 0) FROM data_sources WHERE id = $1",
+		dsID).Scan(&records)
+	if err != nil {
+		return nil, err
+	}
+
+	if records > size*fullScanFactor {
+		q := `
+SELECT record_id, COALESCE(outlink_id, '')
+	FROM name_string_indices TABLESAMPLE SYSTEM ($3)
+	WHERE data_source_id = $1
+	LIMIT $2`
+		pct := min(100, 300*float64(size)/float64(records))
+		res, err := b.queryOutlinks(ctx, q, dsID, size, pct)
+		if err != nil || len(res) == size {
+			return res, err
+		}
+		slog.Info("Sampled blocks have few records, reading data-source",
+			"data-source", dsID, "records", len(res))
+	}
+
+	q := `
+SELECT record_id, COALESCE(outlink_id, '')
+	FROM name_string_indices
+	WHERE data_source_id = $1
+	ORDER BY random()
+	LIMIT $2`
+	return b.queryOutlinks(ctx, q, dsID, size)
+}
+
+// queryOutlinks runs a query that returns record IDs and outlink IDs.
+func (b *buildio) queryOutlinks(
+	ctx context.Context,
+	q string,
+	args ...any,
+) ([]sampledOutlink, error) {
+	rows, err := b.db.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (sampledOutlink, error) {
+		var res sampledOutlink
+		err := row.Scan(&res.recordID, &res.outlinkID)
+		return res, err
+	})
+}
+
+// duplicateOutlinks finds records of a data-source that have more than one
+// outlink ID. It returns one of the outlink IDs of every such record.
+func (b *buildio) duplicateOutlinks(
+	ctx context.Context,
+	dsID int,
+	recordIDs []string,
+) ([]string, error) {
+	if len(recordIDs) == 0 {
+		return nil, nil
+	}
+	q := `
+SELECT min(COALESCE(outlink_id, ''))
+	FROM name_string_indices
+	WHERE data_source_id = $1 AND record_id = ANY($2)
+	GROUP BY record_id
+	HAVING count(DISTINCT COALESCE(outlink_id, '')) > 1`
+	rows, err := b.db.Query(ctx, q, dsID, recordIDs)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// checkRecord counts problems of the outlink of one sampled record.
+func (c *outlinkCheck) checkRecord(outlinkID string) {
+	link := c.render(outlinkID)
+	switch {
+	case outlinkID == "":
+		c.emptyIDs++
+		c.addExample(link)
+	case !isWellFormedURL(link):
+		c.unescaped++
+		c.addExample(link)
+	}
+}
+
+// render creates a URL from the template of the data-source.
+func (c *outlinkCheck) render(id string) string {
+	return strings.ReplaceAll(c.outlinkURL, "{}", id)
+}
+
+func (c *outlinkCheck) addExample(link string) {
+	if c.example == "" {
+		c.example = link
+	}
+}
+
+// isWellFormedURL checks that a URL can be used without escaping.
+func isWellFormedURL(link string) bool {
+	for _, r := range link {
+		if r > unicode.MaxASCII || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return false
+		}
+		if strings.ContainsRune(`"<>\^{|}`+"`", r) {
+			return false
+		}
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	return u.Scheme != "" && u.Host != ""
+}
+
+func printOutlinkChecks(checks []outlinkCheck) {
+	w := os.Stdout
+	fmt.Fprintf(w, "\n%-6s %-25s %-5s %8s %6s %9s %6s  %-6s %s\n",
+		"id", "title", "ready", "records", "empty", "unescaped", "dups",
+		"status", "problems")
+	for _, c := range checks {
+		status := "PASS"
+		problems := c.problems()
+		if len(problems) > 0 {
+			status = "FAIL"
+		}
+		title := c.titleShort
+		if rs := []rune(title); len(rs) > 25 {
+			title = string(rs[:22]) + "..."
+		}
+		fmt.Fprintf(w, "%-6d %-25s %-5t %8d %6d %9d %6d  %-6s %s\n",
+			c.id, title, c.isReady, c.records, c.emptyIDs, c.unescaped,
+			c.duplicates, status, strings.Join(problems, ", "))
+		if c.example != "" {
+			fmt.Fprintf(w, "%6s example: %s\n", "", c.example)
+		}
+	}
+	fmt.Fprintln(w)
+}
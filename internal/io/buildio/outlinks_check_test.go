@@ -0,0 +1,79 @@
+package buildio
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestIsWellFormedURL(t *testing.T) {
+	tests := []struct {
+		msg  string
+		link string
+		want bool
+	}{
+		{"good", "https://www.catalogueoflife.org/data/taxon/4QHKG", true},
+		{"query", "https://eol.org/pages/123?lang=en&x=1", true},
+		{"escaped", "https://example.org/Aus%20bus", true},
+		{"leftover placeholder", "https://example.org/{}", false},
+		{"space", "https://example.org/Aus bus", false},
+		{"tab", "https://example.org/Aus\tbus", false},
+		{"non-ASCII", "https://example.org/Aüs", false},
+		{"quote", `https://example.org/"Aus"`, false},
+		{"no scheme", "example.org/123", false},
+		{"no host", "https:///123", false},
+		{"relative", "/taxon/123", false},
+		{"empty", "", false},
+	}
+
+	for _, v := range tests {
+		if res := isWellFormedURL(v.link); res != v.want {
+			t.Errorf("%s: got %t, want %t", v.msg, res, v.want)
+		}
+	}
+}
+
+func TestOutlinkProblems(t *testing.T) {
+	tmpl := "https://example.org/taxon/{}"
+	tests := []struct {
+		msg        string
+		outlinkURL string
+		outlinkIDs []string
+		duplicates int
+		want       []string
+	}{
+		{"pass", tmpl, []string{"1", "2"}, 0, nil},
+		{"no template", "", []string{"1"}, 0,
+			[]string{"no template", "unescaped characters"}},
+		{"no placeholder", "https://example.org/taxon", []string{"1"}, 0,
+			[]string{"no {} in template"}},
+		{"no records", tmpl, nil, 0, []string{"no records"}},
+		{"empty ID", tmpl, []string{"1", ""}, 0, []string{"empty IDs"}},
+		{"space in ID", tmpl, []string{"Aus bus"}, 0,
+			[]string{"unescaped characters"}},
+		{"non-ASCII ID", tmpl, []string{"Aüs"}, 0,
+			[]string{"unescaped characters"}},
+		{"placeholder in ID", tmpl, []string{"{}"}, 0,
+			[]string{"unescaped characters"}},
+		{"duplicates", tmpl, []string{"1"}, 1,
+			[]string{"duplicate outlinks"}},
+		{"several", tmpl, []string{"", "a b", "1"}, 2,
+			[]string{
+				"empty IDs", "unescaped characters", "duplicate outlinks",
+			}},
+	}
+
+	for _, v := range tests {
+		c := outlinkCheck{outlinkURL: v.outlinkURL, duplicates: v.duplicates}
+		c.records = len(v.outlinkIDs)
+		for _, id := range v.outlinkIDs {
+			c.checkRecord(id)
+		}
+		if res := c.problems(); !slices.Equal(res, v.want) {
+			t.Errorf("%s: got %v, want %v", v.msg, res, v.want)
+		}
+		failed := c.emptyIDs + c.unescaped
+		if failed > 0 && c.outlinkURL != "" && c.example == "" {
+			t.Errorf("%s: no example of a failed outlink", v.msg)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package buildio
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"golang.org/x/sync/errgroup"
+)
+
+// pipeline imports rows of CSV files of the dump. One reader sends rows,
+// they are grouped into batches, workers convert batches of rows into
+// data, and writers save the data to the database. Channels between the
+// stages are bounded, so a slow stage slows down the stages before it. The
+// first error cancels the whole pipeline and is returned by run.
+type pipeline[T any] struct {
+	// name identifies the pipeline in logs.
+	name string
+
+	// read sends rows to the pipeline by calling emit. It has to stop when
+	// emit returns an error.
+	read readFunc
+
+	// newWorker creates a converter for one worker goroutine.
+	newWorker func() (converter[T], error)
+
+	// write saves converted data and returns the number of saved rows. If
+	// it is nil, converted data is discarded.
+	write func(ctx context.Context, data T) (int64, error)
+
+	// workers is the number of goroutines that convert batches.
+	workers int
+
+	// writers is the number of goroutines that save data.
+	writers int
+
+	// batchSize is the number of rows in a batch.
+	batchSize int
+
+	// progress is the format of the progress line with placeholders for
+	// the number of saved rows and the speed. If empty, the progress is not
+	// shown.
+	progress string
+}
+
+// converter converts batches of rows. Every worker of a pipeline has its
+// own converter, so converters do not need to be safe for concurrent use.
+type converter[T any] interface {
+	convert(rows [][]string) (T, error)
+
+	// close is called when the worker stops, after the last batch or after
+	// an error.
+	close() error
+}
+
+// convertFunc is a converter without state.
+type convertFunc[T any] func(rows [][]string) (T, error)
+
+func (f convertFunc[T]) convert(rows [][]string) (T, error) { return f(rows) }
+
+func (convertFunc[T]) close() error { return nil }
+
+// newConvertFunc returns a newWorker function of a converter without state.
+func newConvertFunc[T any](
+	f func(rows [][]string) (T, error),
+) func() (converter[T], error) {
+	return func() (converter[T], error) {
+		return convertFunc[T](f), nil
+	}
+}
+
+// run runs the pipeline until all rows are saved, an error happens or the
+// context is canceled.
+func (p *pipeline[T]) run(ctx context.Context) error {
+	workers, writers := max(p.workers, 1), max(p.writers, 1)
+	batchSize := max(p.batchSize, 1)
+	m := newPipelineMetrics()
+	var prog *progress
+	if p.progress != "" && p.write != nil {
+		prog = newProgress(p.progress)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	chRows := make(chan [][]string, workers)
+	chOut := make(chan T, writers)
+
+	g.Go(func() error {
+		defer close(chRows)
+		start := time.Now()
+		var wait time.Duration
+		defer func() {
+			m.read.busy.Add(int64(time.Since(start) - wait))
+		}()
+
+		batch := make([][]string, 0, batchSize)
+		emit := func(row []string) error {
+			batch = append(batch, row)
+			m.read.rows.Add(1)
+			if len(batch) < batchSize {
+				return nil
+			}
+			sent := time.Now()
+			err := send(ctx, chRows, batch)
+			wait += time.Since(sent)
+			batch = make([][]string, 0, batchSize)
+			return err
+		}
+		if err := p.read(ctx, emit); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		return send(ctx, chRows, batch)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		g.Go(func() error {
+			defer wg.Done()
+			c, err := p.newWorker()
+			if err != nil {
+				return err
+			}
+			err = p.convert(ctx, c, chRows, chOut, m)
+			// the converter is closed after errors too, so it does not lose
+			// its unsaved state silently
+			closeErr := c.close()
+			if err == nil {
+				return closeErr
+			}
+			if closeErr != nil {
+				slog.Error("Cannot close pipeline worker",
+					"pipeline", p.name, "error", closeErr)
+			}
+			return err
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(chOut)
+	}()
+
+	for i := 0; i < writers; i++ {
+		g.Go(func() error {
+			for data := range chOut {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if p.write == nil {
+					continue
+				}
+				start := time.Now()
+				saved, err := p.write(ctx, data)
+				if err != nil {
+					return err
+				}
+				m.write.add(int(saved), time.Since(start))
+				if prog != nil {
+					prog.add(saved)
+				}
+			}
+			return nil
+		})
+	}
+
+	err := g.Wait()
+	if prog != nil {
+		prog.done()
+	}
+	if err != nil {
+		slog.Error("Pipeline failed", "pipeline", p.name, "error", err)
+		return err
+	}
+	m.log(p.name)
+	return nil
+}
+
+// convert converts batches of rows by one worker until the channel of rows
+// is closed or an error happens.
+func (p *pipeline[T]) convert(
+	ctx context.Context,
+	c converter[T],
+	chRows <-chan [][]string,
+	chOut chan<- T,
+	m *pipelineMetrics,
+) error {
+	for rows := range chRows {
+		start := time.Now()
+		data, err := c.convert(rows)
+		if err != nil {
+			return err
+		}
+		m.convert.add(len(rows), time.Since(start))
+		if p.write == nil {
+			continue
+		}
+		if err = send(ctx, chOut, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send sends a value to a channel unless the context is canceled.
+func send[T any](ctx context.Context, ch chan<- T, v T) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case ch <- v:
+		return nil
+	}
+}
+
+// stageMetrics counts rows processed by a stage of a pipeline and the time
+// its goroutines spent working on them.
+type stageMetrics struct {
+	rows atomic.Int64
+	busy atomic.Int64
+}
+
+func (s *stageMetrics) add(rows int, busy time.Duration) {
+	s.rows.Add(int64(rows))
+	s.busy.Add(int64(busy))
+}
+
+// pipelineMetrics keeps throughput counters of stages of a pipeline.
+type pipelineMetrics struct {
+	start   time.Time
+	read    stageMetrics
+	convert stageMetrics
+	write   stageMetrics
+}
+
+func newPipelineMetrics() *pipelineMetrics {
+	return &pipelineMetrics{start: time.Now()}
+}
+
+// log reports throughput of the pipeline stages. The speed of a stage is
+// the speed of one of its goroutines, a stage with the lowest speed per
+// goroutine is the first candidate for more goroutines.
+func (m *pipelineMetrics) log(name string) {
+	elapsed := time.Since(m.start)
+	slog.Info("Pipeline finished",
+		"pipeline", name, "time", elapsed.Round(time.Millisecond))
+	stages := []struct {
+		name string
+		m    *stageMetrics
+	}{
+		{"read", &m.read}, {"convert", &m.convert}, {"write", &m.write},
+	}
+	for _, v := range stages {
+		rows := v.m.rows.Load()
+		busy := time.Duration(v.m.busy.Load())
+		var speed int64
+		if busy > 0 {
+			speed = int64(float64(rows) / busy.Seconds())
+		}
+		slog.Info("Pipeline stage",
+			"pipeline", name,
+			"stage", v.name,
+			"rows", humanize.Comma(rows),
+			"busy", busy.Round(time.Millisecond),
+			"rows/sec", humanize.Comma(speed),
+		)
+	}
+}
@@ -0,0 +1,181 @@
+package buildio
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testConverter counts rows of a worker and reports them to sum on close.
+type testConverter struct {
+	rows    int64
+	sum     *atomic.Int64
+	closed  *atomic.Int64
+	failAt  int
+	batches int
+}
+
+var errTest = errors.New("test error")
+
+func (c *testConverter) convert(rows [][]string) (int, error) {
+	c.batches++
+	if c.failAt > 0 && c.batches == c.failAt {
+		return 0, errTest
+	}
+	c.rows += int64(len(rows))
+	return len(rows), nil
+}
+
+func (c *testConverter) close() error {
+	c.sum.Add(c.rows)
+	c.closed.Add(1)
+	return nil
+}
+
+// readRows returns a readFunc that emits num rows, or rows without end if
+// num is negative.
+func readRows(num int) readFunc {
+	return func(ctx context.Context, emit func([]string) error) error {
+		for i := 0; num < 0 || i < num; i++ {
+			if err := emit([]string{strconv.Itoa(i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	tests := []struct {
+		msg       string
+		rows      int
+		batchSize int
+		workers   int
+		writers   int
+	}{
+		{"partial last batch", 10, 3, 1, 1},
+		{"several workers and writers", 1001, 10, 4, 3},
+		{"batch larger than data", 5, 100, 2, 2},
+		{"no rows", 0, 10, 2, 1},
+	}
+
+	for _, v := range tests {
+		var sum, closed, saved atomic.Int64
+		p := pipeline[int]{
+			name: v.msg,
+			read: readRows(v.rows),
+			newWorker: func() (converter[int], error) {
+				return &testConverter{sum: &sum, closed: &closed}, nil
+			},
+			write: func(_ context.Context, n int) (int64, error) {
+				saved.Add(int64(n))
+				return int64(n), nil
+			},
+			workers:   v.workers,
+			writers:   v.writers,
+			batchSize: v.batchSize,
+		}
+		if err := p.run(context.Background()); err != nil {
+			t.Fatalf("%s: %s", v.msg, err)
+		}
+		if res := saved.Load(); res != int64(v.rows) {
+			t.Errorf("%s: saved %d rows, want %d", v.msg, res, v.rows)
+		}
+		if res := sum.Load(); res != int64(v.rows) {
+			t.Errorf("%s: converted %d rows, want %d", v.msg, res, v.rows)
+		}
+		if res := closed.Load(); res != int64(v.workers) {
+			t.Errorf("%s: closed %d workers, want %d", v.msg, res, v.workers)
+		}
+	}
+}
+
+func TestPipelineErrors(t *testing.T) {
+	tests := []struct {
+		msg      string
+		failAt   int
+		writeErr bool
+		readErr  bool
+	}{
+		{"worker error", 3, false, false},
+		{"writer error", 0, true, false},
+		{"reader error", 0, false, true},
+	}
+
+	base := runtime.NumGoroutine()
+	for _, v := range tests {
+		var sum, closed atomic.Int64
+		read := readRows(-1)
+		if v.readErr {
+			read = func(ctx context.Context, emit func([]string) error) error {
+				if err := readRows(50)(ctx, emit); err != nil {
+					return err
+				}
+				return errTest
+			}
+		}
+		p := pipeline[int]{
+			name: v.msg,
+			read: read,
+			newWorker: func() (converter[int], error) {
+				c := testConverter{sum: &sum, closed: &closed, failAt: v.failAt}
+				return &c, nil
+			},
+			write: func(_ context.Context, n int) (int64, error) {
+				if v.writeErr {
+					return 0, errTest
+				}
+				return int64(n), nil
+			},
+			workers:   3,
+			writers:   2,
+			batchSize: 10,
+		}
+		err := p.run(context.Background())
+		if !errors.Is(err, errTest) {
+			t.Errorf("%s: got error %v, want %v", v.msg, err, errTest)
+		}
+		if res := closed.Load(); res != 3 {
+			t.Errorf("%s: closed %d workers, want 3", v.msg, res)
+		}
+	}
+
+	// goroutines that close channels may finish right after run returns
+	for range 100 {
+		if runtime.NumGoroutine() <= base {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if res := runtime.NumGoroutine(); res > base {
+		t.Errorf("%d goroutines leaked", res-base)
+	}
+}
+
+func TestPipelineCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var sum, closed atomic.Int64
+	p := pipeline[int]{
+		name: "cancel",
+		read: readRows(-1),
+		newWorker: func() (converter[int], error) {
+			return &testConverter{sum: &sum, closed: &closed}, nil
+		},
+		write: func(_ context.Context, n int) (int64, error) {
+			// rows are read without end until the first write cancels them
+			cancel()
+			return int64(n), nil
+		},
+		workers:   2,
+		writers:   1,
+		batchSize: 10,
+	}
+	err := p.run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,40 @@
+package buildio
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// progress shows the number of rows saved by parallel database writers.
+type progress struct {
+	// format has placeholders for the total and the speed.
+	format string
+	start  time.Time
+
+	mu    sync.Mutex
+	total int64
+}
+
+func newProgress(format string) *progress {
+	return &progress{format: format, start: time.Now()}
+}
+
+// add counts saved rows and prints the progress.
+func (p *progress) add(saved int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total += saved
+	timeSpent := time.Since(p.start).Seconds()
+	speed := int64(float64(p.total) / timeSpent)
+	fmt.Printf("\r%s", strings.Repeat(" ", 40))
+	fmt.Printf("\r"+p.format, humanize.Comma(p.total), humanize.Comma(speed))
+}
+
+// done finishes the progress line.
+func (p *progress) done() {
+	fmt.Println()
+}
@@ -0,0 +1,203 @@
+package buildio
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gnames/gnfmt"
+	"github.com/gnames/gnsys"
+)
+
+// Types of changes found by reparse.
+const (
+	changeCanonical     = "canonical"
+	changeCanonicalFull = "canonical_full"
+	changeCanonicalStem = "canonical_stem"
+	changeBacteria      = "bacteria"
+	changeVirus         = "virus"
+	changeSurrogate     = "surrogate"
+	changeParseQuality  = "parse_quality"
+)
+
+// reparseRecord describes changes of parsing results of one name-string.
+type reparseRecord struct {
+	NameStringID     string   `json:"nameStringId"`
+	Name             string   `json:"name"`
+	Changes          []string `json:"changes"`
+	OldCanonical     string   `json:"oldCanonical"`
+	NewCanonical     string   `json:"newCanonical"`
+	OldCanonicalFull string   `json:"oldCanonicalFull"`
+	NewCanonicalFull string   `json:"newCanonicalFull"`
+	OldCanonicalStem string   `json:"oldCanonicalStem"`
+	NewCanonicalStem string   `json:"newCanonicalStem"`
+	OldBacteria      bool     `json:"oldBacteria"`
+	NewBacteria      bool     `json:"newBacteria"`
+	OldVirus         bool     `json:"oldVirus"`
+	NewVirus         bool     `json:"newVirus"`
+	OldSurrogate     bool     `json:"oldSurrogate"`
+	NewSurrogate     bool     `json:"newSurrogate"`
+	OldParseQuality  int      `json:"oldParseQuality"`
+	NewParseQuality  int      `json:"newParseQuality"`
+}
+
+var reparseHeader = []string{
+	"name_string_id", "name", "changes",
+	"old_canonical", "new_canonical",
+	"old_canonical_full", "new_canonical_full",
+	"old_canonical_stem", "new_canonical_stem",
+	"old_bacteria", "new_bacteria",
+	"old_virus", "new_virus",
+	"old_surrogate", "new_surrogate",
+	"old_parse_quality", "new_parse_quality",
+}
+
+// newReparseRecord compares saved and new results of parsing.
+func newReparseRecord(r reparseChange) reparseRecord {
+	res := reparseRecord{
+		NameStringID:     r.old.nameStringID,
+		Name:             r.old.name,
+		OldCanonical:     r.old.canonical,
+		OldCanonicalFull: r.old.canonicalFull,
+		OldCanonicalStem: r.old.canonicalStem,
+		OldBacteria:      r.old.bacteria,
+		NewBacteria:      r.new.Bacteria,
+		OldVirus:         r.old.virus,
+		NewVirus:         r.new.Virus,
+		OldSurrogate:     r.old.surrogate,
+		NewSurrogate:     r.new.Surrogate,
+		OldParseQuality:  r.old.parseQuality,
+		NewParseQuality:  r.new.ParseQuality,
+	}
+	if len(r.cans) > 0 {
+		res.NewCanonical = r.cans[0].Value
+		res.NewCanonicalFull = r.cans[0].FullValue
+		res.NewCanonicalStem = r.cans[0].StemValue
+	}
+
+	if r.old.canonicalID != r.new.CanonicalID {
+		res.Changes = append(res.Changes, changeCanonical)
+	}
+	if r.old.canonicalFullID != r.new.CanonicalFullID {
+		res.Changes = append(res.Changes, changeCanonicalFull)
+	}
+	if r.old.canonicalStemID != r.new.CanonicalStemID {
+		res.Changes = append(res.Changes, changeCanonicalStem)
+	}
+	if res.OldBacteria != res.NewBacteria {
+		res.Changes = append(res.Changes, changeBacteria)
+	}
+	if res.OldVirus != res.NewVirus {
+		res.Changes = append(res.Changes, changeVirus)
+	}
+	if res.OldSurrogate != res.NewSurrogate {
+		res.Changes = append(res.Changes, changeSurrogate)
+	}
+	if res.OldParseQuality != res.NewParseQuality {
+		res.Changes = append(res.Changes, changeParseQuality)
+	}
+	return res
+}
+
+func (r reparseRecord) csvRow() []string {
+	b := strconv.FormatBool
+	return []string{
+		r.NameStringID, r.Name, strings.Join(r.Changes, "|"),
+		r.OldCanonical, r.NewCanonical,
+		r.OldCanonicalFull, r.NewCanonicalFull,
+		r.OldCanonicalStem, r.NewCanonicalStem,
+		b(r.OldBacteria), b(r.NewBacteria),
+		b(r.OldVirus), b(r.NewVirus),
+		b(r.OldSurrogate), b(r.NewSurrogate),
+		strconv.Itoa(r.OldParseQuality), strconv.Itoa(r.NewParseQuality),
+	}
+}
+
+// reparseReport writes changes found by reparse to a CSV or JSON lines
+// file and counts them by their type.
+type reparseReport struct {
+	f      *os.File
+	cw     *csv.Writer
+	enc    gnfmt.GNjson
+	total  int64
+	counts map[string]int64
+}
+
+// newReparseReport creates the report file. Its format is detected from
+// the extension of the file.
+func (b *buildio) newReparseReport() (*reparseReport, error) {
+	path := b.cfg.ReparseReport
+	if path == "" {
+		path = filepath.Join(b.cfg.InputDir, "reparse-report.jsonl")
+	}
+	if err := gnsys.MakeDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Writing reparse report", "file", path)
+
+	res := reparseReport{f: f, counts: make(map[string]int64)}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		res.cw = csv.NewWriter(f)
+		if err = res.cw.Write(reparseHeader); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return &res, nil
+}
+
+// Write adds a changed name-string to the report.
+func (r *reparseReport) Write(c reparseChange) error {
+	rec := newReparseRecord(c)
+	r.total++
+	for _, v := range rec.Changes {
+		r.counts[v]++
+	}
+
+	if r.cw != nil {
+		return r.cw.Write(rec.csvRow())
+	}
+	bs, err := r.enc.Encode(rec)
+	if err != nil {
+		return err
+	}
+	_, err = r.f.Write(append(bs, '\n'))
+	return err
+}
+
+// Close flushes and closes the report file.
+func (r *reparseReport) Close() error {
+	if r.cw != nil {
+		r.cw.Flush()
+		if err := r.cw.Error(); err != nil {
+			r.f.Close()
+			return err
+		}
+	}
+	return r.f.Close()
+}
+
+// Summary prints the number of changed name-strings by type of change.
+func (r *reparseReport) Summary(w io.Writer) {
+	fmt.Fprintf(w, "\nChanged name-strings: %s\n", humanize.Comma(r.total))
+	keys := make([]string, 0, len(r.counts))
+	for k := range r.counts {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %-16s %12s\n", k, humanize.Comma(r.counts[k]))
+	}
+	fmt.Fprintln(w)
+}
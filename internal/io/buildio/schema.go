@@ -0,0 +1,288 @@
+package buildio
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gnames/gnidump/pkg/config"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Names of schemas used by a shadow build. The database is built in the
+// staging schema while services keep reading the public schema. After the
+// swap the old public schema becomes the previous schema and is kept as
+// a rollback target.
+const (
+	publicSchema   = "public"
+	stagingSchema  = "gnidump_staging"
+	previousSchema = "gnidump_previous"
+)
+
+// stagingLockKey is the key of PostgreSQL advisory lock that is held while
+// the staging schema is created, rebuilt or swapped.
+const stagingLockKey int64 = 0x676e6964756d70
+
+// schema returns the name of the schema the builder works with.
+func schema(cfg config.Config) string {
+	if cfg.Staging {
+		return stagingSchema
+	}
+	return publicSchema
+}
+
+// lockStaging takes the advisory lock of the staging schema for the
+// session of a connection, so the schema cannot be swapped while it is
+// built. The returned function releases the lock. If the schema does not
+// belong to a shadow build, nothing is locked.
+func lockStaging(
+	ctx context.Context,
+	cfg config.Config,
+	db *pgxpool.Pool,
+) (func(), error) {
+	if !cfg.Staging {
+		return func() {}, nil
+	}
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ok bool
+	q := "SELECT pg_try_advisory_lock($1)"
+	if err = conn.QueryRow(ctx, q, stagingLockKey).Scan(&ok); err != nil {
+		conn.Release()
+		return nil, err
+	}
+	if !ok {
+		conn.Release()
+		return nil, fmt.Errorf(
+			"schema '%s' is used by another gnidump process", stagingSchema,
+		)
+	}
+	release := func() {
+		q := "SELECT pg_advisory_unlock($1)"
+		if _, err := conn.Exec(context.Background(), q, stagingLockKey); err != nil {
+			slog.Warn("Cannot release lock of staging schema", "error", err)
+		}
+		conn.Release()
+	}
+	return release, nil
+}
+
+// Swap validates the staging schema and, in one transaction, makes it the
+// public schema. The old public schema is renamed to the previous schema.
+// The transaction takes the advisory lock of the staging schema, so the
+// schema cannot be changed by a rebuild between validation and the swap.
+func Swap(cfg config.Config) error {
+	db, err := pgxConn(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	exists, err := schemaExists(ctx, db, previousSchema)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf(
+			"schema '%s' exists, discard it before the next swap", previousSchema,
+		)
+	}
+
+	err = pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		var ok bool
+		q := "SELECT pg_try_advisory_xact_lock($1)"
+		if err := tx.QueryRow(ctx, q, stagingLockKey).Scan(&ok); err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf(
+				"schema '%s' is used by another gnidump process", stagingSchema,
+			)
+		}
+		if err := validateStaging(ctx, tx); err != nil {
+			return err
+		}
+
+		exists, err := schemaExists(ctx, tx, publicSchema)
+		if err != nil {
+			return err
+		}
+		if exists {
+			err = renameSchema(ctx, tx, publicSchema, previousSchema)
+			if err != nil {
+				return err
+			}
+		}
+		return renameSchema(ctx, tx, stagingSchema, publicSchema)
+	})
+	if err != nil {
+		slog.Error("Cannot swap schemas", "error", err)
+		return err
+	}
+	slog.Info("Staging schema became public",
+		"rollback-schema", previousSchema)
+	return nil
+}
+
+// Rollback makes the previous schema public again. The current public
+// schema becomes the staging schema, so it can be fixed and swapped later.
+func Rollback(cfg config.Config) error {
+	db, err := pgxConn(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	err = pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		exists, err := schemaExists(ctx, tx, previousSchema)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("schema '%s' does not exist", previousSchema)
+		}
+		exists, err = schemaExists(ctx, tx, stagingSchema)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf(
+				"schema '%s' exists, drop it before the rollback", stagingSchema,
+			)
+		}
+		if err = renameSchema(ctx, tx, publicSchema, stagingSchema); err != nil {
+			return err
+		}
+		return renameSchema(ctx, tx, previousSchema, publicSchema)
+	})
+	if err != nil {
+		slog.Error("Cannot roll back schemas", "error", err)
+		return err
+	}
+	slog.Info("Previous schema became public")
+	return nil
+}
+
+// Discard removes the previous schema, after that the swap cannot be
+// rolled back.
+func Discard(cfg config.Config) error {
+	db, err := pgxConn(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	q := fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", previousSchema)
+	if _, err = db.Exec(context.Background(), q); err != nil {
+		slog.Error("Cannot discard previous schema", "error", err)
+		return err
+	}
+	slog.Info("Previous schema is discarded", "schema", previousSchema)
+	return nil
+}
+
+// querier is implemented by pgxpool.Pool, pgxpool.Conn and pgx.Tx.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func schemaExists(ctx context.Context, db querier, name string) (bool, error) {
+	var res bool
+	q := `SELECT EXISTS (
+	SELECT 1 FROM information_schema.schemata WHERE schema_name = $1
+)`
+	err := db.QueryRow(ctx, q, name).Scan(&res)
+	return res, err
+}
+
+func renameSchema(ctx context.Context, tx pgx.Tx, from, to string) error {
+	q := fmt.Sprintf("ALTER SCHEMA %s RENAME TO %s", from, to)
+	_, err := tx.Exec(ctx, q)
+	return err
+}
+
+// validateStaging checks that the rebuild of the staging schema is finished
+// and its main tables are populated. Approximate sizes of tables in staging
+// and public schemas are reported for comparison.
+func validateStaging(ctx context.Context, db querier) error {
+	slog.Info("Validating staging schema", "schema", stagingSchema)
+	exists, err := schemaExists(ctx, db, stagingSchema)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("schema '%s' does not exist", stagingSchema)
+	}
+
+	var unfinished bool
+	q := fmt.Sprintf(`SELECT
+	to_regclass('%[1]s.build_stages') IS NOT NULL AND
+	EXISTS (SELECT 1 FROM %[1]s.build_stages)`, stagingSchema)
+	if err = db.QueryRow(ctx, q).Scan(&unfinished); err != nil {
+		return err
+	}
+	if unfinished {
+		return fmt.Errorf("rebuild of schema '%s' is not finished", stagingSchema)
+	}
+
+	var hasView bool
+	q = `SELECT EXISTS (
+	SELECT 1 FROM pg_matviews
+		WHERE schemaname = $1 AND matviewname = 'verification'
+)`
+	if err = db.QueryRow(ctx, q, stagingSchema).Scan(&hasView); err != nil {
+		return err
+	}
+	if !hasView {
+		return fmt.Errorf("schema '%s' has no verification view", stagingSchema)
+	}
+
+	tables := []string{
+		"data_sources", "name_strings", "canonicals", "name_string_indices",
+		"words", "word_name_strings",
+	}
+	for _, tbl := range tables {
+		var empty bool
+		q = fmt.Sprintf(
+			"SELECT NOT EXISTS (SELECT 1 FROM %s.%s)", stagingSchema, tbl,
+		)
+		if err = db.QueryRow(ctx, q).Scan(&empty); err != nil {
+			return err
+		}
+		if empty {
+			return fmt.Errorf("table '%s.%s' is empty", stagingSchema, tbl)
+		}
+		slog.Info("Table size",
+			"table", tbl,
+			"staging", humanize.Comma(estimateRows(ctx, db, stagingSchema, tbl)),
+			"public", humanize.Comma(estimateRows(ctx, db, publicSchema, tbl)),
+		)
+	}
+	return nil
+}
+
+// estimateRows returns the approximate number of rows of a table from
+// PostgreSQL statistics. It returns 0 if the table does not exist.
+func estimateRows(
+	ctx context.Context,
+	db querier,
+	schema, tbl string,
+) int64 {
+	var res float64
+	q := `SELECT COALESCE(
+	(SELECT c.reltuples
+		FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2),
+	0)`
+	if err := db.QueryRow(ctx, q, schema, tbl).Scan(&res); err != nil {
+		return 0
+	}
+	return int64(max(res, 0))
+}
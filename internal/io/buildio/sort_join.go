@@ -0,0 +1,285 @@
+package buildio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+
+	"github.com/gnames/gnidump/internal/io/sortio"
+	"github.com/gnames/gnidump/pkg/ent/model"
+	"github.com/gnames/gnparser"
+	"github.com/gnames/gnuuid"
+	"golang.org/x/sync/errgroup"
+)
+
+// Fields of sorted name-strings used by the sort-merge join. The legacy ID
+// is always the first field. Joined rows of indices start with these
+// fields followed by fields of the index.
+const (
+	snIDF            = 0
+	snUUIDF          = 1
+	snCanonicalF     = 2
+	snCanonicalFullF = 3
+	snFields         = 4
+)
+
+// Fields of sorted vernacular strings used by the sort-merge join.
+const (
+	svIDF    = 0
+	svUUIDF  = 1
+	svFields = 2
+)
+
+// readJoinedNameIndices sends name-string indices joined with parsed data
+// of their name-strings, so indices are created without the key-value
+// store. Name-strings and indices of the dump are sorted by the legacy ID
+// of name-strings in bounded memory, and then joined in one pass.
+func (b *buildio) readJoinedNameIndices(
+	ctx context.Context,
+	emit func([]string) error,
+) error {
+	names, err := sortio.New(b.cfg.InputDir, snIDF, b.cfg.SortChunkSize)
+	if err != nil {
+		return err
+	}
+	defer names.Close()
+	indices, err := sortio.New(
+		b.cfg.InputDir, nsiNameStringIDF, b.cfg.SortChunkSize,
+	)
+	if err != nil {
+		return err
+	}
+	defer indices.Close()
+
+	slog.Info("Sorting name-strings and name-string indices")
+	g, gCtx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		return b.sortNameStrings(gCtx, names)
+	})
+	g.Go(func() error {
+		read := b.readCSV(
+			"name_string_indices", b.keepSource(nsiDataSourceIDF),
+		)
+		return read(gCtx, indices.Add)
+	})
+	if err = g.Wait(); err != nil {
+		slog.Error("Cannot sort name-strings data", "error", err)
+		return err
+	}
+
+	nr, err := names.Sort()
+	if err != nil {
+		return err
+	}
+	defer nr.Close()
+	ir, err := indices.Sort()
+	if err != nil {
+		return err
+	}
+	defer ir.Close()
+
+	slog.Info("Joining name-strings with name-string indices")
+	return mergeJoin(ctx, ir, nsiNameStringIDF, nr,
+		func(row, name []string) error {
+			if name == nil {
+				warnNoNameString(row)
+				return fmt.Errorf(
+					"name-string '%s' is not in the dump", row[nsiNameStringIDF],
+				)
+			}
+			return emit(append(slices.Clip(name), row...))
+		})
+}
+
+// convertJoinedNameIndices converts joined rows to name-string indices.
+func (b *buildio) convertJoinedNameIndices(
+	rows [][]string,
+) ([]model.NameStringIndex, error) {
+	var err error
+	res := make([]model.NameStringIndex, len(rows))
+	for i, row := range rows {
+		parsed := parsedData{
+			ID:              row[snUUIDF],
+			CanonicalSimple: row[snCanonicalF],
+			CanonicalFull:   row[snCanonicalFullF],
+		}
+		res[i], err = b.nameStringIndex(row[snFields:], parsed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// sortNameStrings parses name-strings of the dump and adds their parsed
+// data to the sorter.
+func (b *buildio) sortNameStrings(
+	ctx context.Context,
+	s *sortio.Sorter,
+) error {
+	newWorker := func() (converter[[][]string], error) {
+		gnp := gnparser.New(gnparser.NewConfig())
+		return convertFunc[[][]string](func(rows [][]string) ([][]string, error) {
+			res := make([][]string, len(rows))
+			for i, row := range rows {
+				p := newParsedData(gnp.ParseName(row[nsNameF]))
+				res[i] = []string{
+					row[nsIDF], p.ID, p.CanonicalSimple, p.CanonicalFull,
+				}
+			}
+			return res, nil
+		}), nil
+	}
+
+	p := pipeline[[][]string]{
+		name:      "sorting name_strings",
+		read:      b.readCSV("name_strings", nil),
+		newWorker: newWorker,
+		write: func(_ context.Context, rows [][]string) (int64, error) {
+			for _, row := range rows {
+				if err := s.Add(row); err != nil {
+					return 0, err
+				}
+			}
+			return int64(len(rows)), nil
+		},
+		workers: b.cfg.Pipelines.NameStrings.Workers,
+		// the sorter is not safe for concurrent use
+		writers:   1,
+		batchSize: b.cfg.BatchSize,
+	}
+	return p.run(ctx)
+}
+
+// readJoinedVernIndices sends vernacular string indices joined with UUIDs
+// of their vernacular strings, the same way as readJoinedNameIndices.
+func (b *buildio) readJoinedVernIndices(
+	ctx context.Context,
+	emit func([]string) error,
+) error {
+	verns, err := sortio.New(b.cfg.InputDir, svIDF, b.cfg.SortChunkSize)
+	if err != nil {
+		return err
+	}
+	defer verns.Close()
+	indices, err := sortio.New(
+		b.cfg.InputDir, vsiVernStringIDF, b.cfg.SortChunkSize,
+	)
+	if err != nil {
+		return err
+	}
+	defer indices.Close()
+
+	slog.Info("Sorting vernacular strings and vernacular string indices")
+	g, gCtx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		read := b.readCSV("vernacular_strings", keepUniqueVern())
+		return read(gCtx, func(row []string) error {
+			uuid := gnuuid.New(row[vsNameF]).String()
+			return verns.Add([]string{row[vsIDF], uuid})
+		})
+	})
+	g.Go(func() error {
+		read := b.readCSV(
+			"vernacular_string_indices", b.keepSource(vsiDataSourceIDF),
+		)
+		return read(gCtx, indices.Add)
+	})
+	if err = g.Wait(); err != nil {
+		slog.Error("Cannot sort vernacular strings data", "error", err)
+		return err
+	}
+
+	vr, err := verns.Sort()
+	if err != nil {
+		return err
+	}
+	defer vr.Close()
+	ir, err := indices.Sort()
+	if err != nil {
+		return err
+	}
+	defer ir.Close()
+
+	slog.Info("Joining vernacular strings with vernacular string indices")
+	return mergeJoin(ctx, ir, vsiVernStringIDF, vr,
+		func(row, vern []string) error {
+			if vern == nil {
+				warnNoVernString(row)
+				return fmt.Errorf(
+					"vernacular string '%s' is not in the dump",
+					row[vsiVernStringIDF],
+				)
+			}
+			return emit(append(slices.Clip(vern), row...))
+		})
+}
+
+// convertJoinedVernIndices converts joined rows to vernacular string
+// indices.
+func convertJoinedVernIndices(
+	rows [][]string,
+) ([]model.VernacularStringIndex, error) {
+	var err error
+	res := make([]model.VernacularStringIndex, len(rows))
+	for i, row := range rows {
+		res[i], err = vernStringIndex(row[svFields:], row[svUUIDF])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// mergeJoin reads rows sorted by the field at the key position and finds
+// for each of them a lookup row with the same first field. Lookup rows
+// have to be sorted by their first field and have unique keys. The fn
+// function receives nil instead of a lookup row if there is no match.
+func mergeJoin(
+	ctx context.Context,
+	rows *sortio.Reader,
+	key int,
+	lookup *sortio.Reader,
+	fn func(row, match []string) error,
+) error {
+	match, err := lookup.Read()
+	if err == io.EOF {
+		match = nil
+	} else if err != nil {
+		return err
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		row, err := rows.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		k := row[key]
+		for match != nil && sortio.Compare(match[0], k) < 0 {
+			match, err = lookup.Read()
+			if err == io.EOF {
+				match = nil
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if match != nil && match[0] == k {
+			err = fn(row, match)
+		} else {
+			err = fn(row, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package buildio
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/gnames/gnidump/internal/io/sortio"
+)
+
+func TestMergeJoin(t *testing.T) {
+	tests := []struct {
+		msg    string
+		rows   [][]string
+		lookup [][]string
+		want   []string
+		// unordered is true if rows with the same key can come in any order.
+		unordered bool
+	}{
+		{"all match",
+			[][]string{{"a", "2"}, {"b", "1"}},
+			[][]string{{"1", "one"}, {"2", "two"}},
+			[]string{"b:one", "a:two"}, false},
+		{"numeric order",
+			[][]string{{"a", "10"}, {"b", "9"}, {"c", "100"}},
+			[][]string{{"100", "hundred"}, {"9", "nine"}, {"10", "ten"}},
+			[]string{"b:nine", "a:ten", "c:hundred"}, false},
+		{"duplicate row keys",
+			[][]string{{"a", "5"}, {"b", "3"}, {"c", "5"}, {"d", "5"}},
+			[][]string{{"3", "three"}, {"5", "five"}},
+			[]string{"b:three", "a:five", "c:five", "d:five"}, true},
+		{"keys missing in lookup",
+			[][]string{{"a", "1"}, {"b", "2"}, {"c", "4"}, {"d", "7"}},
+			[][]string{{"2", "two"}, {"4", "four"}},
+			[]string{"a:", "b:two", "c:four", "d:"}, false},
+		{"keys missing in rows",
+			[][]string{{"a", "3"}, {"b", "6"}},
+			[][]string{{"1", "one"}, {"3", "three"}, {"5", "five"},
+				{"6", "six"}, {"8", "eight"}},
+			[]string{"a:three", "b:six"}, false},
+		{"empty lookup",
+			[][]string{{"a", "1"}, {"b", "2"}},
+			nil,
+			[]string{"a:", "b:"}, false},
+		{"empty rows",
+			nil,
+			[][]string{{"1", "one"}},
+			nil, false},
+	}
+
+	for _, v := range tests {
+		rows := sortedReader(t, v.rows, 1)
+		lookup := sortedReader(t, v.lookup, 0)
+
+		var res []string
+		err := mergeJoin(context.Background(), rows, 1, lookup,
+			func(row, match []string) error {
+				var val string
+				if match != nil {
+					val = match[1]
+				}
+				res = append(res, row[0]+":"+val)
+				return nil
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := v.want
+		if v.unordered {
+			if res[0] != want[0] {
+				t.Errorf("%s: got %v first, want %v", v.msg, res[0], want[0])
+			}
+			slices.Sort(res)
+			want = slices.Sorted(slices.Values(want))
+		}
+		if !slices.Equal(res, want) {
+			t.Errorf("%s: got %v, want %v", v.msg, res, want)
+		}
+	}
+}
+
+// sortedReader sorts rows by the key field using tiny chunks, so rows are
+// merged from several files.
+func sortedReader(t *testing.T, rows [][]string, key int) *sortio.Reader {
+	s, err := sortio.New(t.TempDir(), key, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	for _, v := range rows {
+		if err = s.Add(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := s.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Close() })
+	return res
+}
@@ -0,0 +1,164 @@
+package buildio
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+
+	"github.com/dustin/go-humanize"
+	"github.com/jackc/pgx/v5"
+)
+
+// sourceStat contains values of a data-source derived from imported data.
+type sourceStat struct {
+	id              int
+	recordCount     int64
+	uniqueNames     int64
+	vernRecordCount int64
+	hasTaxonData    bool
+}
+
+// updateSourceStats derives record counts and HasTaxonData flag of
+// data-sources from the imported indices. A data-source has taxon data if
+// any of its records has accepted record ID or classification. Derived
+// counts are compared with counts of the dump.
+func (b *buildio) updateSourceStats() error {
+	ctx := context.Background()
+	where, dsWhere := "", ""
+	var args []any
+	if b.isIncremental() {
+		// other data-sources keep their statistics
+		where = "WHERE data_source_id = ANY($1)"
+		dsWhere = "AND ds.id = ANY($1)"
+		args = append(args, b.cfg.Sources)
+	}
+
+	q := `
+UPDATE data_sources ds
+	SET
+		record_count = s.records,
+		vern_record_count = s.vern_records,
+		has_taxon_data = s.has_taxa
+	FROM (
+		SELECT
+			d.id,
+			COALESCE(n.records, 0) AS records,
+			COALESCE(n.names, 0) AS names,
+			COALESCE(n.has_taxa, FALSE) AS has_taxa,
+			COALESCE(v.records, 0) AS vern_records
+		FROM data_sources d
+			LEFT JOIN (
+				SELECT
+					data_source_id,
+					count(*) AS records,
+					count(DISTINCT name_string_id) AS names,
+					bool_or(
+						COALESCE(accepted_record_id, '') <> '' OR
+						COALESCE(classification, '') <> ''
+					) AS has_taxa
+				FROM name_string_indices
+				` + where + `
+				GROUP BY data_source_id
+			) n ON n.data_source_id = d.id
+			LEFT JOIN (
+				SELECT data_source_id, count(*) AS records
+				FROM vernacular_string_indices
+				` + where + `
+				GROUP BY data_source_id
+			) v ON v.data_source_id = d.id
+	) s
+	WHERE ds.id = s.id
+		` + dsWhere + `
+	RETURNING ds.id, s.records, s.names, s.vern_records, s.has_taxa`
+
+	rows, err := b.db.Query(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	stats, err := pgx.CollectRows(rows,
+		func(row pgx.CollectableRow) (sourceStat, error) {
+			var res sourceStat
+			err := row.Scan(&res.id, &res.recordCount, &res.uniqueNames,
+				&res.vernRecordCount, &res.hasTaxonData)
+			return res, err
+		})
+	if err != nil {
+		return err
+	}
+	slog.Info("Updated data-sources statistics",
+		"data-sources", humanize.Comma(int64(len(stats))))
+
+	return b.compareSourceStats(stats)
+}
+
+// dumpedCounts are counts of a data-source given by the dump.
+type dumpedCounts struct {
+	nameStrings int64
+	uniqueNames int64
+}
+
+// compareSourceStats warns about data-sources whose derived counts are
+// different from the counts in the dump.
+func (b *buildio) compareSourceStats(stats []sourceStat) error {
+	dumped, err := b.loadDumpedCounts()
+	if err != nil {
+		return err
+	}
+
+	var diff int
+	for _, v := range stats {
+		d, ok := dumped[v.id]
+		if !ok {
+			continue
+		}
+		if d.nameStrings != v.recordCount || d.uniqueNames != v.uniqueNames {
+			diff++
+			slog.Warn("Data-source counts differ from the dump",
+				"data-source", v.id,
+				"records", humanize.Comma(v.recordCount),
+				"name_strings_count", humanize.Comma(d.nameStrings),
+				"unique_names", humanize.Comma(v.uniqueNames),
+				"unique_names_count", humanize.Comma(d.uniqueNames),
+			)
+		}
+	}
+	if diff > 0 {
+		slog.Warn("Some data-sources have counts different from the dump",
+			"data-sources", diff)
+	}
+	return nil
+}
+
+func (b *buildio) loadDumpedCounts() (map[int]dumpedCounts, error) {
+	r, f, err := b.openCSV("data_sources")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// skip header
+	if _, err = r.Read(); err != nil {
+		return nil, err
+	}
+
+	res := make(map[int]dumpedCounts)
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		id, err := strconv.Atoi(row[dsIDF])
+		if err != nil {
+			return nil, err
+		}
+		var c dumpedCounts
+		c.nameStrings, _ = strconv.ParseInt(row[dsNameStringsCountF], 10, 64)
+		c.uniqueNames, _ = strconv.ParseInt(row[dsUniqueNamesCountF], 10, 64)
+		res[id] = c
+	}
+	return res, nil
+}
@@ -0,0 +1,302 @@
+package buildio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Per-source rebuild replaces data of selected data-sources and keeps data
+// of all other data-sources intact. Name-strings that might become orphans
+// after the replacement, and name-strings added by the rebuild are kept in
+// the rebuild_names table. Orphans and words stages use it to limit their
+// work to these name-strings, the table is dropped after words are created.
+// Vernacular strings that might become orphans are kept in the
+// rebuild_verns table until orphans are removed.
+
+// isIncremental is true when the rebuild is limited to some data-sources.
+func (b *buildio) isIncremental() bool {
+	return len(b.cfg.Sources) > 0
+}
+
+// hasSource checks if a data-source ID from a CSV row belongs to the
+// rebuild.
+func (b *buildio) hasSource(id string) bool {
+	if !b.isIncremental() {
+		return true
+	}
+	_, ok := b.sources[id]
+	return ok
+}
+
+// initRebuildTables creates tables for name-strings and vernacular strings
+// touched by per-source rebuild.
+func (b *buildio) initRebuildTables(ctx context.Context) error {
+	qs := []string{
+		`CREATE TABLE IF NOT EXISTS rebuild_names (
+	id UUID PRIMARY KEY,
+	is_new BOOLEAN NOT NULL DEFAULT FALSE
+)`,
+		"CREATE TABLE IF NOT EXISTS rebuild_verns (id UUID PRIMARY KEY)",
+	}
+	return b.execTx(ctx, qs)
+}
+
+// dropRebuildNames removes the rebuild_names table when it is not needed
+// anymore.
+func (b *buildio) dropRebuildNames(ctx context.Context) error {
+	_, err := b.db.Exec(ctx, "DROP TABLE IF EXISTS rebuild_names")
+	return err
+}
+
+// checkDumpSources makes sure that the dump contains all data-sources of
+// the rebuild.
+func (b *buildio) checkDumpSources(dumpSources []int) error {
+	if !b.isIncremental() {
+		return fmt.Errorf(
+			"dump contains only data-sources %v, full rebuild needs a full dump",
+			dumpSources,
+		)
+	}
+	for _, v := range b.cfg.Sources {
+		if !slices.Contains(dumpSources, v) {
+			return fmt.Errorf("dump does not contain data-source %d", v)
+		}
+	}
+	return nil
+}
+
+// sourceNameIDs returns dumped IDs of name-strings used by data-sources of
+// the rebuild. It returns nil if the dump does not contain other
+// data-sources, so all its name-strings are needed.
+func (b *buildio) sourceNameIDs() (map[string]struct{}, error) {
+	m, err := b.manifest()
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Sources) == len(b.cfg.Sources) {
+		return nil, nil
+	}
+
+	slog.Info("Collecting name-strings of data-sources", "sources", b.cfg.Sources)
+	r, f, err := b.openCSV("name_string_indices")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// skip header
+	if _, err = r.Read(); err != nil {
+		return nil, err
+	}
+	res := make(map[string]struct{})
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b.hasSource(row[nsiDataSourceIDF]) {
+			res[row[nsiNameStringIDF]] = struct{}{}
+		}
+	}
+}
+
+// deleteSourceIndices removes name-string indices of data-sources of the
+// rebuild. Their name-strings are saved as candidates for orphans.
+func (b *buildio) deleteSourceIndices(ctx context.Context) error {
+	qs := []string{
+		`INSERT INTO rebuild_names (id)
+	SELECT DISTINCT name_string_id
+		FROM name_string_indices
+		WHERE data_source_id = ANY($1)
+	ON CONFLICT DO NOTHING`,
+		"DELETE FROM name_string_indices WHERE data_source_id = ANY($1)",
+	}
+	return b.execTx(ctx, qs, b.cfg.Sources)
+}
+
+// deleteSourceVernIndices removes vernacular indices of data-sources of
+// the rebuild. Their vernacular strings are saved as candidates for
+// orphans.
+func (b *buildio) deleteSourceVernIndices(ctx context.Context) error {
+	qs := []string{
+		`INSERT INTO rebuild_verns (id)
+	SELECT DISTINCT vernacular_string_id
+		FROM vernacular_string_indices
+		WHERE data_source_id = ANY($1)
+	ON CONFLICT DO NOTHING`,
+		"DELETE FROM vernacular_string_indices WHERE data_source_id = ANY($1)",
+	}
+	return b.execTx(ctx, qs, b.cfg.Sources)
+}
+
+// execTx runs queries with the same arguments in one transaction.
+func (b *buildio) execTx(ctx context.Context, qs []string, args ...any) error {
+	return pgx.BeginFunc(ctx, b.db, func(tx pgx.Tx) error {
+		for _, q := range qs {
+			if _, err := tx.Exec(ctx, q, args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// removeSourceOrphans removes name-strings, canonicals, word links and
+// vernacular strings that lost all their indices during per-source rebuild.
+// Words that lost all their name-strings are removed as well.
+func (b *buildio) removeSourceOrphans() error {
+	ctx := context.Background()
+	slog.Info("Removing orphans of rebuilt data-sources")
+
+	var names, verns int64
+	err := pgx.BeginFunc(ctx, b.db, func(tx pgx.Tx) error {
+		q := `
+CREATE TEMP TABLE orphan_names (
+	id UUID, canonical_id UUID, canonical_full_id UUID, canonical_stem_id UUID
+) ON COMMIT DROP`
+		if _, err := tx.Exec(ctx, q); err != nil {
+			return err
+		}
+
+		q = `
+WITH del AS (
+	DELETE FROM name_strings ns
+		USING rebuild_names rn
+		WHERE ns.id = rn.id AND NOT EXISTS (
+			SELECT 1 FROM name_string_indices nsi
+				WHERE nsi.name_string_id = ns.id
+		)
+		RETURNING ns.id, ns.canonical_id, ns.canonical_full_id,
+			ns.canonical_stem_id
+)
+INSERT INTO orphan_names SELECT * FROM del`
+		tag, err := tx.Exec(ctx, q)
+		if err != nil {
+			return err
+		}
+		names = tag.RowsAffected()
+
+		qs := []string{
+			`CREATE TEMP TABLE orphan_words (id UUID) ON COMMIT DROP`,
+			`WITH del AS (
+	DELETE FROM word_name_strings wns
+		USING orphan_names o
+		WHERE wns.name_string_id = o.id
+		RETURNING wns.word_id
+)
+INSERT INTO orphan_words SELECT DISTINCT word_id FROM del`,
+			`DELETE FROM words w
+	USING orphan_words o
+	WHERE w.id = o.id AND NOT EXISTS (
+		SELECT 1 FROM word_name_strings wns WHERE wns.word_id = w.id
+	)`,
+			canonicalOrphansQuery("canonicals", "canonical_id"),
+			canonicalOrphansQuery("canonical_fulls", "canonical_full_id"),
+			canonicalOrphansQuery("canonical_stems", "canonical_stem_id"),
+			`DELETE FROM rebuild_names rn
+	USING orphan_names o
+	WHERE rn.id = o.id`,
+		}
+		for _, q := range qs {
+			if _, err = tx.Exec(ctx, q); err != nil {
+				return err
+			}
+		}
+
+		q = `
+DELETE FROM vernacular_strings vs
+	USING rebuild_verns rv
+	WHERE vs.id = rv.id AND NOT EXISTS (
+		SELECT 1 FROM vernacular_string_indices vsi
+			WHERE vsi.vernacular_string_id = vs.id
+	)`
+		if tag, err = tx.Exec(ctx, q); err != nil {
+			return err
+		}
+		verns = tag.RowsAffected()
+
+		// rebuild_verns is not needed after orphans are removed
+		_, err = tx.Exec(ctx, "DROP TABLE IF EXISTS rebuild_verns")
+		return err
+	})
+	if err != nil {
+		slog.Error("Cannot remove orphans", "error", err)
+		return err
+	}
+	slog.Info("Removed orphan name-strings", "names", names)
+	slog.Info("Removed orphan vernacular strings", "vernaculars", verns)
+	return nil
+}
+
+// canonicalOrphansQuery deletes canonical forms of orphan name-strings
+// that are not used by any other name-string.
+func canonicalOrphansQuery(tbl, col string) string {
+	return fmt.Sprintf(`
+DELETE FROM %[1]s c
+	USING orphan_names o
+	WHERE c.id = o.%[2]s AND NOT EXISTS (
+		SELECT 1 FROM name_strings ns WHERE ns.%[2]s = c.id
+	)`, tbl, col)
+}
+
+// refreshVerification recalculates the verification view. PostgreSQL
+// cannot refresh a part of a materialized view, so the whole view is
+// refreshed. If the view has a unique row index, it is refreshed
+// concurrently and readers are not blocked. The view is created if it does
+// not exist yet.
+func (b *buildio) refreshVerification() error {
+	ctx := context.Background()
+	var exists bool
+	q := "SELECT EXISTS (SELECT 1 FROM pg_matviews WHERE matviewname = 'verification')"
+	if err := b.db.QueryRow(ctx, q).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return b.createVerification()
+	}
+
+	var concurrent bool
+	q = `
+SELECT EXISTS (
+	SELECT 1 FROM pg_indexes
+		WHERE schemaname = current_schema() AND indexname = $1
+)`
+	err := b.db.QueryRow(ctx, q, verificationRowIndex).Scan(&concurrent)
+	if err != nil {
+		return err
+	}
+
+	q = "REFRESH MATERIALIZED VIEW CONCURRENTLY verification"
+	if !concurrent {
+		slog.Warn("Verification view has no unique row index, " +
+			"readers are blocked during refresh")
+		q = "REFRESH MATERIALIZED VIEW verification"
+	}
+	slog.Info("Refreshing verification view, it will take some time...")
+	_, err = b.db.Exec(ctx, q)
+	if err != nil {
+		slog.Error("Cannot refresh verification view", "error", err)
+		return err
+	}
+	slog.Info("View verification is refreshed")
+	return nil
+}
+
+// sourcesSet converts IDs of data-sources to a set of strings, so they can
+// be compared with fields of CSV rows.
+func sourcesSet(ids []int) map[string]struct{} {
+	res := make(map[string]struct{}, len(ids))
+	for _, v := range ids {
+		res[strconv.Itoa(v)] = struct{}{}
+	}
+	return res
+}
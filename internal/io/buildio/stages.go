@@ -0,0 +1,309 @@
+package buildio
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Names of the rebuild stages in the order of their execution.
+const (
+	stageNames        = "names"
+	stageSources      = "sources"
+	stageIndices      = "indices"
+	stageVern         = "vern"
+	stageVernIndices  = "vern-indices"
+	stageReparse      = "reparse"
+	stageVernLang     = "vern-lang"
+	stageOrphans      = "orphans"
+	stageSourceStats  = "source-stats"
+	stageWords        = "words"
+	stageVerification = "verification"
+)
+
+// stage is one step of the rebuild process.
+type stage struct {
+	// name is used to select the stage from the command line and to record
+	// its completion in the checkpoint table.
+	name string
+
+	// desc describes what the stage does.
+	desc string
+
+	// tables are names of the dumped tables the stage reads from CSV files.
+	tables []string
+
+	// run executes the stage.
+	run func(ctx context.Context) error
+
+	// incremental is true if the stage can run in per-source rebuild.
+	incremental bool
+}
+
+// StageNames returns names of all rebuild stages in the order of their
+// execution.
+func StageNames() []string {
+	stages := (&buildio{}).stages()
+	res := make([]string, len(stages))
+	for i := range stages {
+		res[i] = stages[i].name
+	}
+	return res
+}
+
+// stages returns all rebuild stages in the order of their execution.
+func (b *buildio) stages() []stage {
+	orphans, verification := b.removeOrphans, b.createVerification
+	if b.isIncremental() {
+		orphans, verification = b.removeSourceOrphans, b.refreshVerification
+	}
+	// the sort-merge join reads strings files together with indices, the
+	// key-value stores verify them only if they have to be filled again
+	indices := []string{"name_string_indices"}
+	vernIndices := []string{"vernacular_string_indices"}
+	if b.cfg.SortJoin {
+		indices = append(indices, "name_strings")
+		vernIndices = append(vernIndices, "vernacular_strings")
+	}
+	return []stage{
+		{stageNames, "import name-strings",
+			[]string{"name_strings"}, b.importNameStrings, true},
+		{stageSources, "import data-sources",
+			[]string{"data_sources"}, noCancel(b.importDataSources), true},
+		{stageIndices, "import name-string-indices",
+			indices, b.importNameIndices, true},
+		{stageVern, "import vernacular_strings",
+			[]string{"vernacular_strings"}, b.importVern, true},
+		{stageVernIndices, "import vernacular_indices",
+			vernIndices, b.importVernIndices, true},
+		{stageReparse, "reparse name_strings", nil,
+			noCancel(b.reparseStage), false},
+		{stageVernLang, "fix vernacular language", nil,
+			noCancel(b.fixVernLang), true},
+		{stageOrphans, "remove orphans", nil, noCancel(orphans), true},
+		{stageSourceStats, "derive data-source statistics",
+			[]string{"data_sources"}, noCancel(b.updateSourceStats), true},
+		{stageWords, "create words", nil, noCancel(b.createWords), true},
+		{stageVerification, "create verification", nil,
+			noCancel(verification), true},
+	}
+}
+
+// noCancel adapts a stage that ignores cancellation. Such stage is not
+// interrupted, the rebuild stops after it finishes.
+func noCancel(run func() error) func(context.Context) error {
+	return func(context.Context) error { return run() }
+}
+
+// selectStages returns stages chosen by Steps, FromStep and ToStep settings.
+// Stages are always returned in the order of their execution. Per-source
+// rebuild skips stages that cannot be limited to data-sources, unless they
+// are given in Steps explicitly, which is an error.
+func (b *buildio) selectStages() ([]stage, error) {
+	all := b.stages()
+	names := StageNames()
+
+	for _, v := range b.cfg.Steps {
+		if !slices.Contains(names, v) {
+			return nil, unknownStageError(v)
+		}
+	}
+
+	from, to := 0, len(all)-1
+	if b.cfg.FromStep != "" {
+		if from = slices.Index(names, b.cfg.FromStep); from == -1 {
+			return nil, unknownStageError(b.cfg.FromStep)
+		}
+	}
+	if b.cfg.ToStep != "" {
+		if to = slices.Index(names, b.cfg.ToStep); to == -1 {
+			return nil, unknownStageError(b.cfg.ToStep)
+		}
+	}
+	if from > to {
+		return nil, fmt.Errorf(
+			"stage '%s' goes after stage '%s'", b.cfg.FromStep, b.cfg.ToStep,
+		)
+	}
+
+	var res []stage
+	for i := from; i <= to; i++ {
+		s := all[i]
+		if len(b.cfg.Steps) > 0 && !slices.Contains(b.cfg.Steps, s.name) {
+			continue
+		}
+		if b.isIncremental() && !s.incremental {
+			if len(b.cfg.Steps) > 0 {
+				return nil, fmt.Errorf(
+					"stage '%s' cannot run for selected data-sources", s.name,
+				)
+			}
+			slog.Info("Skipping stage in per-source rebuild", "stage", s.name)
+			continue
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+func unknownStageError(name string) error {
+	return fmt.Errorf(
+		"unknown stage '%s', use one of: %s",
+		name, strings.Join(StageNames(), ","),
+	)
+}
+
+// runStages executes given stages. Stages that were completed by a previous
+// unfinished rebuild of the same data-sources are skipped. CSV files needed
+// by the remaining stages are verified before any stage starts.
+// The checkpoint is cleared when the last of all rebuild stages is done.
+// A partial run that stops earlier removes only records of its own stages,
+// so checkpoints of an unfinished full rebuild survive it.
+func (b *buildio) runStages(ctx context.Context, stages []stage) error {
+	var err error
+
+	if err = b.initCheckpoint(ctx); err != nil {
+		slog.Error("Cannot create checkpoint table", "error", err)
+		return err
+	}
+	if b.cfg.Restart {
+		if err = b.clearCheckpoint(ctx); err != nil {
+			slog.Error("Cannot clear checkpoint", "error", err)
+			return err
+		}
+	}
+
+	done, err := b.loadCheckpoint(ctx)
+	if err != nil {
+		slog.Error("Cannot read checkpoint", "error", err)
+		return err
+	}
+
+	var pending []stage
+	var tables []string
+	for _, s := range stages {
+		if finished, ok := done[s.name]; ok {
+			slog.Info("Skipping stage completed by a previous run",
+				"stage", s.name, "finished", finished.Format(time.RFC3339))
+			continue
+		}
+		pending = append(pending, s)
+		for _, v := range s.tables {
+			if !slices.Contains(tables, v) {
+				tables = append(tables, v)
+			}
+		}
+	}
+
+	if len(tables) > 0 {
+		if err = b.verifyDump(tables); err != nil {
+			slog.Error("Cannot use CSV dump", "error", err)
+			return err
+		}
+	}
+
+	for _, s := range pending {
+		if err = ctx.Err(); err != nil {
+			slog.Error("Rebuild is canceled", "stage", s.name)
+			return err
+		}
+		slog.Info("Starting stage", "stage", s.name)
+		if err = s.run(ctx); err != nil {
+			slog.Error("Cannot "+s.desc, "stage", s.name, "error", err)
+			return err
+		}
+
+		if err = b.saveCheckpoint(ctx, s.name); err != nil {
+			slog.Error("Cannot save checkpoint", "stage", s.name, "error", err)
+			return err
+		}
+	}
+
+	all := b.stages()
+	last := all[len(all)-1].name
+	if slices.ContainsFunc(stages, func(s stage) bool { return s.name == last }) {
+		return b.clearCheckpoint(ctx)
+	}
+	names := make([]string, len(pending))
+	for i := range pending {
+		names[i] = pending[i].name
+	}
+	return b.clearStages(ctx, names)
+}
+
+// initCheckpoint creates a table that keeps names of completed stages.
+func (b *buildio) initCheckpoint(ctx context.Context) error {
+	q := `
+CREATE TABLE IF NOT EXISTS build_stages (
+	name VARCHAR(50) PRIMARY KEY,
+	sources TEXT NOT NULL DEFAULT '',
+	finished_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+)`
+	_, err := b.db.Exec(ctx, q)
+	return err
+}
+
+// checkpointSources identifies data-sources of a rebuild in the checkpoint.
+// It is empty for a full rebuild.
+func (b *buildio) checkpointSources() string {
+	return strings.Trim(fmt.Sprint(b.cfg.Sources), "[]")
+}
+
+// loadCheckpoint returns completed stages with their completion time.
+// Stages completed by a rebuild of different data-sources are ignored.
+func (b *buildio) loadCheckpoint(
+	ctx context.Context,
+) (map[string]time.Time, error) {
+	res := make(map[string]time.Time)
+	q := "SELECT name, sources, finished_at FROM build_stages"
+	rows, err := b.db.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, sources string
+		var finished time.Time
+		if err = rows.Scan(&name, &sources, &finished); err != nil {
+			return nil, err
+		}
+		if sources != b.checkpointSources() {
+			slog.Warn("Ignoring stage completed by a rebuild of other data-sources",
+				"stage", name, "sources", sources)
+			continue
+		}
+		res[name] = finished
+	}
+	return res, rows.Err()
+}
+
+// saveCheckpoint records a completed stage.
+func (b *buildio) saveCheckpoint(ctx context.Context, name string) error {
+	q := `
+INSERT INTO build_stages (name, sources, finished_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (name) DO UPDATE
+		SET sources = EXCLUDED.sources, finished_at = EXCLUDED.finished_at`
+	_, err := b.db.Exec(ctx, q, name, b.checkpointSources(), time.Now().UTC())
+	return err
+}
+
+// clearCheckpoint removes records about completed stages.
+func (b *buildio) clearCheckpoint(ctx context.Context) error {
+	_, err := b.db.Exec(ctx, "DELETE FROM build_stages")
+	return err
+}
+
+// clearStages removes records about the given stages.
+func (b *buildio) clearStages(ctx context.Context, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	q := "DELETE FROM build_stages WHERE name = ANY($1)"
+	_, err := b.db.Exec(ctx, q, names)
+	return err
+}
@@ -2,21 +2,12 @@ package buildio
 
 import (
 	"context"
-	"encoding/csv"
-	"fmt"
-	"io"
 	"log/slog"
-	"os"
-	"path/filepath"
-	"strings"
-	"time"
 
-	"github.com/dgraph-io/badger/v2"
-	"github.com/dustin/go-humanize"
 	"github.com/gnames/gnfmt"
+	"github.com/gnames/gnidump/internal/ent/kv"
 	"github.com/gnames/gnidump/pkg/ent/model"
 	"github.com/gnames/gnuuid"
-	"golang.org/x/sync/errgroup"
 )
 
 // List of fields from name-strings CSV file. The value correspondes to the
@@ -28,7 +19,7 @@ const (
 
 // importVern imports takes data from vernacular_strings.csv file and
 // uploads it to the database.
-func (b *buildio) importVern() error {
+func (b *buildio) importVern(ctx context.Context) error {
 	slog.Info("Uploading data for vernacular_strings table")
 
 	err := b.kvVern.Open()
@@ -38,204 +29,122 @@ func (b *buildio) importVern() error {
 	}
 	defer b.kvVern.Close()
 
-	_ = b.truncateTable("vernacular_strings")
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	g, ctx := errgroup.WithContext(ctx)
-
-	chIn := make(chan []string)
-	chOut := make(chan []model.VernacularString)
-
-	g.Go(func() error {
-		defer close(chIn)
-		return b.loadVernStrings(ctx, chIn)
-	})
-
-	g.Go(func() error {
-		defer close(chOut)
-		return b.workerVernString(ctx, chIn, chOut)
-	})
-
-	g.Go(func() error {
-		return b.dbVernString(ctx, chOut)
-	})
-
-	if err := g.Wait(); err != nil {
-		slog.Error("error in goroutines", "error", err)
+	// the store is filled again from the dump
+	if err = b.kvVern.Reset(); err != nil {
+		slog.Error("Cannot reset key-value store", "error", err)
 		return err
 	}
 
-	return nil
-}
-
-func (b *buildio) loadVernStrings(ctx context.Context, chIn chan<- []string) error {
-	dupl := make(map[string]struct{})
-
-	path := filepath.Join(b.cfg.DumpDir, "vernacular_strings.csv")
+	if !b.isIncremental() {
+		_ = b.truncateTable("vernacular_strings")
+	}
 
-	f, err := os.Open(path)
-	if err != nil {
-		slog.Error("Cannot open csv file", "error", err)
+	pl := b.cfg.Pipelines.VernStrings
+	p := pipeline[[]model.VernacularString]{
+		name:      "vernacular_strings",
+		read:      b.readCSV("vernacular_strings", keepUniqueVern()),
+		newWorker: b.newVernStringConverter,
+		write: func(_ context.Context, vs []model.VernacularString) (int64, error) {
+			return b.saveVernStrings(vs)
+		},
+		workers:   pl.Workers,
+		writers:   pl.Writers,
+		batchSize: b.cfg.BatchSize,
+		progress:  "Uploaded %s verns, %s verns/sec",
+	}
+	if err = p.run(ctx); err != nil {
 		return err
 	}
-	defer f.Close()
-	r := csv.NewReader(f)
 
-	// skip header
-	_, err = r.Read()
-	if err != nil {
-		slog.Error("Cannot read csv header", "error", err)
+	if err = b.saveKVStamp(b.kvVern, "vernacular_strings", nil); err != nil {
+		slog.Error("Cannot save key-value store stamp", "error", err)
 		return err
 	}
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			row, err := r.Read()
-			if err == io.EOF {
-				return nil
-			}
-			if err != nil {
-				slog.Error("Cannot read CSV line", "error", err)
-				return err
-			}
-			if _, ok := dupl[row[vsNameF]]; ok {
-				fmt.Println(row)
-				continue
-			}
-			dupl[row[vsNameF]] = struct{}{}
-			chIn <- row
-		}
-	}
+	slog.Info("Uploaded vernacular_strings table")
+	return nil
 }
 
-func (b *buildio) workerVernString(
-	ctx context.Context,
-	chIn <-chan []string,
-	chOut chan<- []model.VernacularString,
-) error {
-	var err error
-	var kvTxn *badger.Txn
-	var vrn model.VernacularString
-
-	kvTxn, err = b.kvVern.GetTransaction()
-	if err != nil {
-		slog.Error("Cannot make kvVern transaction", "error", err)
-		return err
-	}
-	res := make([]model.VernacularString, b.cfg.BatchSize)
-	var i int
-
-	for row := range chIn {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			vrn, kvTxn, err = b.processVernRow(kvTxn, row)
-			if err != nil {
-				return err
-			}
-
-			if i < b.cfg.BatchSize {
-				res[i] = vrn
-			} else {
-				chOut <- res
-				i = 0
-				res = make([]model.VernacularString, b.cfg.BatchSize)
-				res[i] = vrn
-			}
-			i++
+// keepUniqueVern returns a filter that skips vernacular strings that were
+// already seen.
+func keepUniqueVern() func(row []string) bool {
+	dupl := make(map[string]struct{})
+	return func(row []string) bool {
+		if _, ok := dupl[row[vsNameF]]; ok {
+			slog.Debug("Duplicate vernacular string",
+				"id", row[vsIDF], "name", row[vsNameF])
+			return false
 		}
+		dupl[row[vsNameF]] = struct{}{}
+		return true
 	}
+}
 
-	err = kvTxn.Commit()
+// vernStringConverter creates vernacular strings and saves their UUIDs to
+// the key-value store.
+type vernStringConverter struct {
+	b       *buildio
+	kvBatch kv.Batch
+}
+
+func (b *buildio) newVernStringConverter() (
+	converter[[]model.VernacularString],
+	error,
+) {
+	kvBatch, err := b.kvVern.NewBatch()
 	if err != nil {
-		slog.Error("Cannot commit key/value transaction", "error", err)
-		return err
+		slog.Error("Cannot make kvVern batch", "error", err)
+		return nil, err
 	}
-
-	chOut <- res[0:i]
-	return nil
+	return &vernStringConverter{b: b, kvBatch: kvBatch}, nil
 }
 
-func (b *buildio) dbVernString(
-	ctx context.Context,
-	chOut <-chan []model.VernacularString,
-) error {
+func (c *vernStringConverter) convert(
+	rows [][]string,
+) ([]model.VernacularString, error) {
 	var err error
-	var saved, total int64
-	timeStart := time.Now().UnixNano()
-
-	for vrn := range chOut {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			saved, err = b.saveVernStrings(vrn)
-			if err != nil {
-				slog.Error("Cannot save vernacular_strings", "error", err)
-				return err
-			}
-			total += saved
-			timeSpent := float64(time.Now().UnixNano()-timeStart) / 1_000_000_000
-			speed := int64(float64(total) / timeSpent)
-			fmt.Printf("\r%s", strings.Repeat(" ", 40))
-			fmt.Printf(
-				"\rUploaded %s verns, %s verns/sec",
-				humanize.Comma(total), humanize.Comma(speed),
-			)
+	res := make([]model.VernacularString, len(rows))
+	for i, row := range rows {
+		res[i], err = c.b.processVernRow(c.kvBatch, row)
+		if err != nil {
+			return nil, err
 		}
 	}
-	fmt.Println()
-	slog.Info("Uploaded vernacular_strings table")
-	return nil
+	return res, nil
+}
+
+func (c *vernStringConverter) close() error {
+	err := c.kvBatch.Commit()
+	if err != nil {
+		slog.Error("Cannot commit key/value batch", "error", err)
+	}
+	return err
 }
 
 func (b *buildio) processVernRow(
-	kvTxn *badger.Txn,
+	kvBatch kv.Batch,
 	row []string,
-) (model.VernacularString, *badger.Txn, error) {
-	var err error
+) (model.VernacularString, error) {
 	var vrn model.VernacularString
-	var valBytes []byte
 	enc := gnfmt.GNgob{}
 	id := row[vsIDF]
 	name := row[vsNameF]
 	key := id
 	val := gnuuid.New(name).String()
 
-	valBytes, err = enc.Encode(val)
+	valBytes, err := enc.Encode(val)
 	if err != nil {
 		slog.Error("Cannot encode value", "error", err)
-		return vrn, kvTxn, err
+		return vrn, err
 	}
 
-	if err = kvTxn.Set([]byte(key), []byte(valBytes)); err == badger.ErrTxnTooBig {
-		err = kvTxn.Commit()
-		if err != nil {
-			slog.Error("Cannot commit key/value transaction", "error", err)
-			return vrn, kvTxn, err
-		}
-
-		kvTxn, err = b.kvVern.GetTransaction()
-		if err != nil {
-			slog.Error("Cannot make transaction", "error", err)
-			return vrn, kvTxn, err
-		}
-
-		err = kvTxn.Set([]byte(key), []byte(valBytes))
-		if err != nil {
-			slog.Error("Cannot set key/value", "error", err)
-			return vrn, kvTxn, err
-		}
+	if err = kvBatch.Set([]byte(key), valBytes); err != nil {
+		slog.Error("Cannot set key/value", "error", err)
+		return vrn, err
 	}
 
 	vrn = model.VernacularString{
 		ID:   val,
 		Name: name,
 	}
-	return vrn, kvTxn, nil
+	return vrn, nil
 }
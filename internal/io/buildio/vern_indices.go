@@ -2,20 +2,12 @@ package buildio
 
 import (
 	"context"
-	"encoding/csv"
-	"fmt"
-	"io"
 	"log/slog"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
-	"github.com/dustin/go-humanize"
 	"github.com/gnames/gnfmt"
 	"github.com/gnames/gnidump/pkg/ent/model"
-	"golang.org/x/sync/errgroup"
 	"golang.org/x/text/language"
 )
 
@@ -53,41 +45,55 @@ var langMap = map[string]string{
 	"Zulu":       "zul",
 }
 
-func (b *buildio) importVernIndices() error {
-	err := b.kvVern.Open()
-	if err != nil {
-		slog.Error("cannot open key-value store", "error", err)
-		return err
-	}
-	defer b.kvVern.Close()
+func (b *buildio) importVernIndices(ctx context.Context) error {
+	var err error
+	// the sort-merge join does not use the key-value store
+	if !b.cfg.SortJoin {
+		if err = b.kvVern.Open(); err != nil {
+			slog.Error("cannot open key-value store", "error", err)
+			return err
+		}
+		defer b.kvVern.Close()
 
-	_ = b.truncateTable("vernacular_string_indices")
+		if err = b.prepareVernKV(ctx); err != nil {
+			slog.Error("Cannot prepare key-value store", "error", err)
+			return err
+		}
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	g, ctx := errgroup.WithContext(ctx)
+	if b.isIncremental() {
+		err = b.deleteSourceVernIndices(ctx)
+		if err != nil {
+			slog.Error("Cannot delete vernacular indices of data-sources",
+				"error", err)
+			return err
+		}
+	} else {
+		_ = b.truncateTable("vernacular_string_indices")
+	}
 
 	slog.Info("Uploading data for vernacular_string_indices table")
 
-	chIn := make(chan []string)
-	chOut := make(chan []model.VernacularStringIndex)
-
-	g.Go(func() error {
-		defer close(chIn)
-		return b.loadVernStringIndices(ctx, chIn)
-	})
-
-	g.Go(func() error {
-		defer close(chOut)
-		return b.workerVernStringIndex(ctx, chIn, chOut)
-	})
-
-	g.Go(func() error {
-		return b.dbVernStringIndices(ctx, chOut)
-	})
-
-	if err := g.Wait(); err != nil {
-		slog.Error("error in goroutines", "error", err)
+	pl := b.cfg.Pipelines.VernIndices
+	p := pipeline[[]model.VernacularStringIndex]{
+		name: "vernacular_string_indices",
+		read: b.readCSV(
+			"vernacular_string_indices", b.keepSource(vsiDataSourceIDF),
+		),
+		newWorker: newConvertFunc(b.convertVernIndices),
+		write: func(_ context.Context, vsi []model.VernacularStringIndex) (int64, error) {
+			return b.saveVernStringIndices(vsi)
+		},
+		workers:   pl.Workers,
+		writers:   pl.Writers,
+		batchSize: b.cfg.BatchSize,
+		progress:  "Uploaded %s indices, %s names/sec",
+	}
+	if b.cfg.SortJoin {
+		p.read = b.readJoinedVernIndices
+		p.newWorker = newConvertFunc(convertJoinedVernIndices)
+	}
+	if err = p.run(ctx); err != nil {
 		return err
 	}
 
@@ -95,134 +101,88 @@ func (b *buildio) importVernIndices() error {
 	return nil
 }
 
-func (b *buildio) dbVernStringIndices(
-	ctx context.Context,
-	chOut <-chan []model.VernacularStringIndex,
-) error {
-	var err error
-	var saved, total int64
-	timeStart := time.Now().UnixNano()
-
-	for vsi := range chOut {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			saved, err = b.saveVernStringIndices(vsi)
-			if err != nil {
-				slog.Error("cannot save vernacular_string_indices", "error", err)
-				return err
-			}
-			total += saved
-			timeSpent := float64(time.Now().UnixNano()-timeStart) / 1_000_000_000
-			speed := int64(float64(total) / timeSpent)
-			fmt.Printf("\r%s", strings.Repeat(" ", 40))
-			fmt.Printf("\rUploaded %s indices, %s names/sec",
-				humanize.Comma(total), humanize.Comma(speed))
-		}
+// convertVernIndices converts a batch of rows to vernacular string
+// indices. UUIDs of vernacular strings for the batch are taken from the
+// key-value store by one bulk read.
+func (b *buildio) convertVernIndices(
+	rows [][]string,
+) ([]model.VernacularStringIndex, error) {
+	enc := gnfmt.GNgob{}
+	keys := make([][]byte, len(rows))
+	for i, row := range rows {
+		keys[i] = []byte(row[vsiVernStringIDF])
+	}
+	vals, err := b.kvVern.GetValues(keys)
+	if err != nil {
+		slog.Error("Cannot get values", "error", err)
+		return nil, err
 	}
-	fmt.Println()
-	return nil
-}
 
-func (b *buildio) workerVernStringIndex(
-	ctx context.Context,
-	chIn <-chan []string,
-	chOut chan<- []model.VernacularStringIndex,
-) error {
-	enc := gnfmt.GNgob{}
-	res := make([]model.VernacularStringIndex, b.cfg.BatchSize)
-	i := 0
-	for row := range chIn {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			dsID, err := strconv.Atoi(row[vsiDataSourceIDF])
-			if err != nil {
-				slog.Error("cannot convert data_source_id to int", "error", err)
-				return err
-			}
-			var uuid string
-			uuidBytes, err := b.kvVern.GetValue([]byte(row[vsiVernStringIDF]))
-			if err != nil {
-				slog.Error("Cannot get Value", "error", err,
-					"data-source", row[nsiDataSourceIDF],
-					"record", row[nsIDF],
-				)
-				return err
-			}
-
-			err = enc.Decode(uuidBytes, &uuid)
-			if err != nil {
-				slog.Error("cannot decode uuid", "error", err)
-				return err
-			}
-
-			vsi := model.VernacularStringIndex{
-				DataSourceID:       dsID,
-				VernacularStringID: uuid,
-				RecordID:           row[vsiTaxonIDF],
-				Language:           row[vsiLangIDF],
-				Locality:           row[vsiLocalityIDF],
-				CountryCode:        row[vsiCountryCodeIDF],
-			}
-
-			// normalize to ISO 639-3  (3-letter code) where possible
-			tag, err := language.Parse(strings.ToLower(vsi.Language))
-			if err == nil {
-				base, _ := tag.Base()
-				vsi.LangCode = base.ISO3()
-			} else {
-				if iso, ok := langMap[vsi.Language]; ok {
-					vsi.LangCode = iso
-				}
-			}
-
-			if i < b.cfg.BatchSize {
-				res[i] = vsi
-			} else {
-				chOut <- res
-				i = 0
-				res = make([]model.VernacularStringIndex, b.cfg.BatchSize)
-				res[i] = vsi
-			}
-			i++
+	res := make([]model.VernacularStringIndex, len(rows))
+	for i, row := range rows {
+		res[i], err = processVernIdxRow(row, vals[i], enc)
+		if err != nil {
+			return nil, err
 		}
 	}
-	chOut <- res[0:i]
-	return nil
+	return res, nil
 }
 
-func (b *buildio) loadVernStringIndices(ctx context.Context, chIn chan<- []string) error {
-	path := filepath.Join(b.cfg.DumpDir, "vernacular_string_indices.csv")
-	f, err := os.Open(path)
+func processVernIdxRow(
+	row []string,
+	uuidBytes []byte,
+	enc gnfmt.GNgob,
+) (model.VernacularStringIndex, error) {
+	if uuidBytes == nil {
+		warnNoVernString(row)
+	}
+	var uuid string
+	err := enc.Decode(uuidBytes, &uuid)
 	if err != nil {
-		slog.Error("cannot open vernacular_string_indices.csv", "error", err)
+		slog.Error("cannot decode uuid", "error", err)
+		return model.VernacularStringIndex{}, err
 	}
-	defer f.Close()
-	r := csv.NewReader(f)
+	return vernStringIndex(row, uuid)
+}
 
-	// skip header
-	_, err = r.Read()
+func warnNoVernString(row []string) {
+	slog.Warn("Cannot find key", "key", row[vsiVernStringIDF],
+		"data-source", row[vsiDataSourceIDF],
+		"record", row[vsiTaxonIDF],
+	)
+}
+
+// vernStringIndex creates a vernacular string index from a row of the dump
+// and UUID of its vernacular string.
+func vernStringIndex(
+	row []string,
+	uuid string,
+) (model.VernacularStringIndex, error) {
+	var vsi model.VernacularStringIndex
+	dsID, err := strconv.Atoi(row[vsiDataSourceIDF])
 	if err != nil {
-		slog.Error("cannot read the header vernacular_string_indices", "error", err)
+		slog.Error("cannot convert data_source_id to int", "error", err)
+		return vsi, err
+	}
+
+	vsi = model.VernacularStringIndex{
+		DataSourceID:       dsID,
+		VernacularStringID: uuid,
+		RecordID:           row[vsiTaxonIDF],
+		Language:           row[vsiLangIDF],
+		Locality:           row[vsiLocalityIDF],
+		CountryCode:        row[vsiCountryCodeIDF],
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			row, err := r.Read()
-			if err == io.EOF {
-				return nil
-			}
-			if err != nil {
-				slog.Error("cannot read vernacular_string_indices.csv", "error", err)
-				return err
-			}
-			chIn <- row
+	// normalize to ISO 639-3  (3-letter code) where possible
+	tag, err := language.Parse(strings.ToLower(vsi.Language))
+	if err == nil {
+		base, _ := tag.Base()
+		vsi.LangCode = base.ISO3()
+	} else {
+		if iso, ok := langMap[vsi.Language]; ok {
+			vsi.LangCode = iso
 		}
 	}
+	return vsi, nil
 }
@@ -1,6 +1,7 @@
 package buildio
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"strings"
@@ -19,10 +20,12 @@ func (b *buildio) createWords() error {
 
 	slog.Info("Creating words for words tables")
 
-	err = b.truncateTable("words", "word_name_strings")
-	if err != nil {
-		slog.Error("Cannot truncate tables", "error", err)
-		return err
+	if !b.isIncremental() {
+		err = b.truncateTable("words", "word_name_strings")
+		if err != nil {
+			slog.Error("Cannot truncate tables", "error", err)
+			return err
+		}
 	}
 
 	rows, err = b.getWordNames()
@@ -75,6 +78,10 @@ func (b *buildio) createWords() error {
 	fmt.Println()
 	b.saveNameWords(wordNames)
 	b.prepWords(wordsMap)
+	if b.isIncremental() {
+		// rebuild_names is not needed after words are created
+		return b.dropRebuildNames(context.Background())
+	}
 	return nil
 }
 
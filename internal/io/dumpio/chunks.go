@@ -0,0 +1,263 @@
+package dumpio
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gnames/gnsys"
+	"golang.org/x/sync/errgroup"
+)
+
+// chunk is a key range of a large table. It is read by one query and
+// saved into its own part-file.
+type chunk struct {
+	// Args are parameters of the query that selects rows of the chunk.
+	Args []int64 `json:"args"`
+}
+
+func (c chunk) args() []any {
+	res := make([]any, len(c.Args))
+	for i := range c.Args {
+		res[i] = c.Args[i]
+	}
+	return res
+}
+
+// rowWriter saves CSV rows.
+type rowWriter interface {
+	Write(row []string) error
+}
+
+// rowHandler reads rows of a query and saves them as CSV rows.
+type rowHandler func(rows *sql.Rows, w rowWriter, p *progress) error
+
+// progress prints the number of rows downloaded by all workers.
+type progress struct {
+	msg   string
+	step  int64
+	count atomic.Int64
+}
+
+func newProgress(msg string, step int64) *progress {
+	return &progress{msg: msg, step: step}
+}
+
+func (p *progress) inc() {
+	if n := p.count.Add(1); n%p.step == 0 {
+		fmt.Printf("\r%s", strings.Repeat(" ", 35))
+		fmt.Printf("\r"+p.msg, humanize.Comma(n))
+	}
+}
+
+func (p *progress) done() {
+	fmt.Printf("\r%s", strings.Repeat(" ", 35))
+	fmt.Printf("\r"+p.msg+"\n", humanize.Comma(p.count.Load()))
+}
+
+// partFile is a CSV file with rows of one chunk. It has no header and is
+// not compressed.
+type partFile struct {
+	f    *os.File
+	bw   *bufio.Writer
+	w    *csv.Writer
+	rows int64
+}
+
+func newPartFile(path string) (*partFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	bw := bufio.NewWriter(f)
+	return &partFile{f: f, bw: bw, w: csv.NewWriter(bw)}, nil
+}
+
+// Write writes a data row to the part-file.
+func (p *partFile) Write(row []string) error {
+	p.rows++
+	return p.w.Write(row)
+}
+
+// Close flushes data to disk and closes the part-file.
+func (p *partFile) Close() error {
+	defer p.f.Close()
+	p.w.Flush()
+	if err := p.w.Error(); err != nil {
+		return err
+	}
+	if err := p.bw.Flush(); err != nil {
+		return err
+	}
+	if err := p.f.Sync(); err != nil {
+		return err
+	}
+	return p.f.Close()
+}
+
+// partsDir returns the directory for part-files of a table.
+func (d *dumpio) partsDir(table string) string {
+	return filepath.Join(d.cfg.DumpDir, "parts", table)
+}
+
+// partPath returns the path to the part-file of a chunk.
+func (d *dumpio) partPath(table string, idx int) string {
+	return filepath.Join(d.partsDir(table), fmt.Sprintf("%06d.csv", idx))
+}
+
+// dumpChunked reads chunks of a table in parallel using all snapshot
+// connections. Every chunk is saved to its own part-file. When all chunks
+// are read, part-files are merged in their order into the CSV file of the
+// table.
+//
+// The plan of chunks and completed chunks are recorded in the dump state.
+// A resumed dump uses the recorded plan and reads only chunks that were
+// not completed.
+func (d *dumpio) dumpChunked(
+	table string,
+	header []string,
+	q string,
+	plan func() ([]chunk, error),
+	handle rowHandler,
+	p *progress,
+) error {
+	err := gnsys.MakeDir(d.partsDir(table))
+	if err != nil {
+		return err
+	}
+
+	ts := d.tableState(table)
+	if ts.Chunks == nil {
+		chunks, err := plan()
+		if err != nil {
+			return err
+		}
+		d.stateMu.Lock()
+		ts.Chunks = chunks
+		d.stateMu.Unlock()
+		if err = d.saveState(); err != nil {
+			return err
+		}
+	}
+	chunks := ts.Chunks
+
+	rows := make([]int64, len(chunks))
+	var todo []int
+	for i := range chunks {
+		if n, ok := ts.Done[i]; ok {
+			rows[i] = n
+			continue
+		}
+		todo = append(todo, i)
+	}
+	if len(todo) < len(chunks) {
+		slog.Info("Skipping chunks finished by a previous run",
+			"table", table, "chunks", len(chunks)-len(todo))
+	}
+
+	chIdx := make(chan int)
+	g, ctx := errgroup.WithContext(context.Background())
+
+	g.Go(func() error {
+		defer close(chIdx)
+		for _, i := range todo {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case chIdx <- i:
+			}
+		}
+		return nil
+	})
+
+	for _, conn := range d.conns {
+		g.Go(func() error {
+			for i := range chIdx {
+				n, err := d.dumpChunk(ctx, conn, table, i, q, chunks[i], handle, p)
+				if err != nil {
+					return err
+				}
+				rows[i] = n
+				if err = d.chunkDone(table, i, n); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	if err = g.Wait(); err != nil {
+		return err
+	}
+	p.done()
+
+	return d.mergeParts(table, header, rows)
+}
+
+// dumpChunk saves rows of one chunk to its part-file.
+func (d *dumpio) dumpChunk(
+	ctx context.Context,
+	conn *sql.Conn,
+	table string,
+	idx int,
+	q string,
+	c chunk,
+	handle rowHandler,
+	p *progress,
+) (int64, error) {
+	rows, err := conn.QueryContext(ctx, q, c.args()...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	w, err := newPartFile(d.partPath(table, idx))
+	if err != nil {
+		return 0, err
+	}
+	if err = handle(rows, w, p); err != nil {
+		w.Close()
+		return 0, err
+	}
+	if err = w.Close(); err != nil {
+		return 0, err
+	}
+	return w.rows, nil
+}
+
+// mergeParts concatenates part-files of a table into its CSV file and
+// removes them.
+func (d *dumpio) mergeParts(table string, header []string, rows []int64) error {
+	w, err := d.csvFile(table, header)
+	if err != nil {
+		return err
+	}
+	for i := range rows {
+		err = w.appendPart(d.partPath(table, i), rows[i])
+		if err != nil {
+			return err
+		}
+	}
+	if err = d.saveCSV(w); err != nil {
+		return err
+	}
+	return os.RemoveAll(d.partsDir(table))
+}
+
+// idChunks splits the range of IDs from min to max into chunks of the
+// given size.
+func idChunks(minID, maxID, size int64) []chunk {
+	var res []chunk
+	for lo := minID; lo <= maxID; lo += size {
+		res = append(res, chunk{Args: []int64{lo, lo + size}})
+	}
+	return res
+}
@@ -0,0 +1,128 @@
+package dumpio
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/gnames/gnidump/internal/ent/dump"
+	"github.com/klauspost/compress/zstd"
+)
+
+// csvFile is a CSV file of the dump. It counts rows and bytes written to
+// the file and calculates its SHA-256 checksum. If compression is set,
+// the data is compressed before it reaches the file.
+type csvFile struct {
+	entry dump.File
+	f     *os.File
+	hash  hash.Hash
+	cw    *countWriter
+	zw    io.WriteCloser
+	out   io.Writer
+	w     *csv.Writer
+}
+
+// countWriter counts bytes that go through it.
+type countWriter struct {
+	w     io.Writer
+	bytes int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.bytes += int64(n)
+	return n, err
+}
+
+// csvFile creates a CSV file for a table and writes its header.
+func (d *dumpio) csvFile(table string, header []string) (*csvFile, error) {
+	ext, err := dump.CompressionExt(d.cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+	name := table + ".csv" + ext
+	f, err := os.Create(filepath.Join(d.cfg.DumpDir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	res := csvFile{
+		entry: dump.File{Table: table, Name: name, Header: header},
+		f:     f,
+		hash:  sha256.New(),
+	}
+	res.cw = &countWriter{w: io.MultiWriter(f, res.hash)}
+
+	var w io.Writer = res.cw
+	switch dump.CompressionFromName(name) {
+	case dump.Gzip:
+		res.zw = gzip.NewWriter(res.cw)
+		w = res.zw
+	case dump.Zstd:
+		res.zw, err = zstd.NewWriter(res.cw)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		w = res.zw
+	}
+	res.out = w
+	res.w = csv.NewWriter(w)
+
+	if err = res.w.Write(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Write writes a data row to the file.
+func (c *csvFile) Write(row []string) error {
+	c.entry.Rows++
+	return c.w.Write(row)
+}
+
+// appendPart copies already formatted CSV rows from a part-file.
+func (c *csvFile) appendPart(path string, rows int64) error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = io.Copy(c.out, f); err != nil {
+		return err
+	}
+	c.entry.Rows += rows
+	return nil
+}
+
+// Close flushes the data to disk, closes the file and returns its
+// description for the manifest.
+func (c *csvFile) Close() (dump.File, error) {
+	defer c.f.Close()
+
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return c.entry, err
+	}
+	if c.zw != nil {
+		if err := c.zw.Close(); err != nil {
+			return c.entry, err
+		}
+	}
+	if err := c.f.Sync(); err != nil {
+		return c.entry, err
+	}
+	c.entry.Bytes = c.cw.bytes
+	c.entry.SHA256 = hex.EncodeToString(c.hash.Sum(nil))
+	return c.entry, c.f.Close()
+}
@@ -1,8 +1,8 @@
 package dumpio
 
 import (
+	"context"
 	"database/sql"
-	"encoding/csv"
 	"fmt"
 	"log/slog"
 	"strconv"
@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/dustin/go-humanize"
+	"github.com/gnames/gnidump/internal/ent/datasource"
+	"github.com/gnames/gnidump/internal/ent/dump"
 )
 
 // NewDb creates a handler for interaction with MySQL database.
@@ -28,15 +30,19 @@ func (d *dumpio) dbURI() string {
 	return url
 }
 
+// updateDataSourcesDate sets updated_at of data-sources in GNI database to
+// the date of their latest harvest. It modifies GNI database and runs only
+// if SyncDates option is set.
 func (d *dumpio) updateDataSourcesDate() error {
 	var id int
+	var ids []int
 	update := `UPDATE data_sources
 							SET updated_at = (
 								SELECT updated_at
 								  FROM name_string_indices
-									  WHERE data_source_id = %d LIMIT 1
+									  WHERE data_source_id = ? LIMIT 1
 								)
-							WHERE id = %d`
+							WHERE id = ?`
 	q := `SELECT DISTINCT id
 	        FROM data_sources ds
 					  JOIN name_string_indices nsi
@@ -51,55 +57,82 @@ func (d *dumpio) updateDataSourcesDate() error {
 		if err != nil {
 			return err
 		}
-		uq := fmt.Sprintf(update, id, id)
-		rows, err = d.db.Query(uq)
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		_, err = d.db.Exec(update, id, id)
 		if err != nil {
 			return err
 		}
-		defer rows.Close()
 	}
 	return nil
 }
 
 func (d *dumpio) dumpTableDataSources() error {
 	slog.Info("Create data_sources.csv")
-	q1 := `SELECT data_source_id, count(*)
-	          FROM name_string_indices
-						  GROUP BY data_source_id`
-	q2 := `SELECT id, title, description,
+	q := `SELECT id, title, description,
 	 	  		logo_url, web_site_url, data_url,
 	 	  		refresh_period_days, name_strings_count,
-	 	  		data_hash, unique_names_count, created_at, updated_at
-	 	  	FROM data_sources`
-	rows, err := d.db.Query(q1)
+	 	  		data_hash, unique_names_count, created_at,
+	 	  		` + updatedAtExpr + ` AS updated_at
+	 	  	FROM data_sources ds`
+	stats, err := d.nsiStats()
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-	recNum, err := collectDataSourceRecords(rows)
-	if err != nil {
-		return err
+	recNum := make(map[int]int)
+	for _, v := range stats {
+		recNum[v.dataSourceID] = int(v.count)
 	}
-	rows, err = d.db.Query(q2)
+	rows, err := d.conn.QueryContext(context.Background(), q)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
-	d.handleDataSource(rows, recNum)
-	return nil
+	return d.handleDataSource(rows, recNum)
 }
 
-func collectDataSourceRecords(rows *sql.Rows) (map[int]int, error) {
-	res := make(map[int]int)
-	var id, recNum int
+// nsiStat provides the number of name-string indices of a data-source
+// and the range of their name-string IDs.
+type nsiStat struct {
+	dataSourceID         int
+	count                int64
+	minNameID, maxNameID int64
+}
+
+// nsiStats collects statistics of name-string indices of all data-sources.
+// The result is cached, because it requires a full scan of a large table.
+func (d *dumpio) nsiStats() ([]nsiStat, error) {
+	if d.stats != nil {
+		return d.stats, nil
+	}
+	q := `SELECT data_source_id, count(*),
+					MIN(name_string_id), MAX(name_string_id)
+	          FROM name_string_indices
+						  GROUP BY data_source_id`
+	rows, err := d.conn.QueryContext(context.Background(), q)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
+
+	var res []nsiStat
 	for rows.Next() {
-		err := rows.Scan(&id, &recNum)
+		var st nsiStat
+		err = rows.Scan(&st.dataSourceID, &st.count, &st.minNameID, &st.maxNameID)
 		if err != nil {
-			return res, err
+			return nil, err
 		}
-		res[id] = recNum
+		res = append(res, st)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
+	d.stats = res
 	return res, nil
 }
 
@@ -111,19 +144,12 @@ func (d *dumpio) handleDataSource(rows *sql.Rows, recNum map[int]int) error {
 	var description, logoURL, webSiteURL sql.NullString
 	var dataURL, dataHash sql.NullString
 	var createdAt, updatedAt time.Time
-	curated, autoCurated := d.qualityMaps()
-	file, err := d.csvFile("data_sources")
+	reg, err := datasource.Load(d.cfg.InputDir)
 	if err != nil {
+		slog.Error("Cannot load data-sources registry", "error", err)
 		return err
 	}
-	defer file.Close()
-	w := csv.NewWriter(file)
-
-	err = w.Write([]string{"id", "title", "description",
-		"logo_url", "web_site_url", "data_url",
-		"refresh_period_days", "name_strings_count",
-		"data_hash", "unique_names_count", "created_at",
-		"updated_at", "is_curated", "is_auto_curated", "record_count"})
+	w, err := d.csvFile("data_sources", dump.Headers["data_sources"])
 	if err != nil {
 		return err
 	}
@@ -141,10 +167,10 @@ func (d *dumpio) handleDataSource(rows *sql.Rows, recNum map[int]int) error {
 		updated := updatedAt.Format(time.RFC3339)
 		isCurated := "f"
 		isAutoCurated := "f"
-		if _, ok := curated[id]; ok {
+		if reg[id].IsCurated {
 			isCurated = "t"
 		}
-		if _, ok := autoCurated[id]; ok {
+		if reg[id].IsAutoCurated {
 			isAutoCurated = "t"
 		}
 		csvRow := []string{strconv.Itoa(id), title, description.String,
@@ -160,132 +186,131 @@ func (d *dumpio) handleDataSource(rows *sql.Rows, recNum map[int]int) error {
 			return err
 		}
 	}
-	w.Flush()
-	file.Sync()
-	return nil
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	return d.saveCSV(w)
 }
 
-func (d *dumpio) qualityMaps() (curated, autoCurated map[int]struct{}) {
-	curated = make(map[int]struct{})
-	autoCurated = make(map[int]struct{})
-
-	for _, v := range d.cfg.Curated {
-		curated[v] = struct{}{}
+func (d *dumpio) dumpTableNameStrings() error {
+	slog.Info("Create name_strings.csv")
+	size := int64(d.cfg.DumpChunkSize)
+	plan := func() ([]chunk, error) {
+		if d.isIncremental() {
+			return d.incrementalNameChunks(size)
+		}
+		var minID, maxID sql.NullInt64
+		q := "SELECT MIN(id), MAX(id) FROM name_strings"
+		err := d.conn.QueryRowContext(context.Background(), q).Scan(&minID, &maxID)
+		if err != nil {
+			return nil, err
+		}
+		return idChunks(minID.Int64, maxID.Int64, size), nil
 	}
 
-	for _, v := range d.cfg.AutoCurated {
-		autoCurated[v] = struct{}{}
-	}
-	return curated, autoCurated
+	q := `SELECT id, name
+					FROM name_strings
+					WHERE id >= ? AND id < ?`
+	if d.isIncremental() {
+		q += `
+					AND id IN (
+						SELECT name_string_id
+							FROM name_string_indices
+							WHERE data_source_id IN (` + d.sourceIDs() + `))`
+	}
+	q += `
+					ORDER BY id`
+	p := newProgress("Downloaded %s names to a CSV file", 1_000_000)
+	return d.dumpChunked(
+		"name_strings", dump.Headers["name_strings"], q, plan,
+		handleNameStrings, p,
+	)
 }
 
-func (d dumpio) dumpTableNameStrings() error {
-	slog.Info("Create name_strings.csv")
-	q := `SELECT id, name
-					FROM name_strings`
-	rows, err := d.db.Query(q)
-	if err != nil {
-		return err
+// incrementalNameChunks splits the range of name-string IDs used by
+// data-sources of an incremental dump into chunks.
+func (d *dumpio) incrementalNameChunks(size int64) ([]chunk, error) {
+	stats, err := d.sourceStats()
+	if err != nil || len(stats) == 0 {
+		return nil, err
 	}
-	defer rows.Close()
-
-	err = d.handleNameStrings(rows)
-	if err != nil {
-		return err
+	minID, maxID := stats[0].minNameID, stats[0].maxNameID
+	for _, v := range stats[1:] {
+		minID = min(minID, v.minNameID)
+		maxID = max(maxID, v.maxNameID)
 	}
-	return nil
+	return idChunks(minID, maxID, size), nil
 }
 
-func (d dumpio) handleNameStrings(rows *sql.Rows) error {
+func handleNameStrings(rows *sql.Rows, w rowWriter, p *progress) error {
 	var id string
 	var name string
-	file, err := d.csvFile("name_strings")
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	w := csv.NewWriter(file)
-	err = w.Write([]string{"id", "name"})
-	if err != nil {
-		return err
-	}
-
-	var count int64
 	for rows.Next() {
-		count++
-		if count%1_000_000 == 0 {
-			fmt.Printf("\r%s", strings.Repeat(" ", 35))
-			fmt.Printf("\rDownloaded %s names to a CSV file", humanize.Comma(count))
-		}
-		if err = rows.Scan(&id, &name); err != nil {
+		p.inc()
+		if err := rows.Scan(&id, &name); err != nil {
 			return err
 		}
 		name = strings.ReplaceAll(name, "\u0000", "")
 		csvRow := []string{id, name}
 
-		err = w.Write(csvRow)
-		if err != nil {
+		if err := w.Write(csvRow); err != nil {
 			return err
 		}
 	}
-
-	w.Flush()
-	file.Sync()
-	fmt.Printf("\r%s", strings.Repeat(" ", 35))
-	fmt.Printf("\rDownloaded %s names to a CSV file\n", humanize.Comma(count))
-	return nil
+	return rows.Err()
 }
 
 func (d *dumpio) dumpTableNameStringIndices() error {
 	slog.Info("Create name_string_indices.csv")
+	plan := func() ([]chunk, error) {
+		stats, err := d.sourceStats()
+		if err != nil {
+			return nil, err
+		}
+		return nsiChunks(stats, int64(d.cfg.DumpChunkSize)), nil
+	}
+
 	q := `SELECT data_source_id, name_string_id,
 					url, taxon_id, global_id, local_id,
 					nomenclatural_code_id, rank,
 					accepted_taxon_id, classification_path,
 					classification_path_ids,
 					classification_path_ranks
-					FROM name_string_indices`
-	rows, err := d.db.Query(q)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-	err = d.handleNameStringIndices(rows)
-	if err != nil {
-		return err
-	}
+					FROM name_string_indices
+					WHERE data_source_id = ? AND
+					  name_string_id >= ? AND name_string_id < ?`
+	header := dump.Headers["name_string_indices"]
+	p := newProgress("Downloaded %s name indices to a CSV file", 100_000)
+	return d.dumpChunked(
+		"name_string_indices", header, q, plan, handleNameStringIndices, p,
+	)
+}
 
-	return nil
+// nsiChunks splits name-string indices of every data-source into chunks by
+// ranges of name-string IDs. The number of chunks of a data-source depends
+// on the number of its records.
+func nsiChunks(stats []nsiStat, size int64) []chunk {
+	var res []chunk
+	for _, st := range stats {
+		n := (st.count + size - 1) / size
+		step := (st.maxNameID-st.minNameID)/n + 1
+		for lo := st.minNameID; lo <= st.maxNameID; lo += step {
+			args := []int64{int64(st.dataSourceID), lo, lo + step}
+			res = append(res, chunk{Args: args})
+		}
+	}
+	return res
 }
 
-func (d *dumpio) handleNameStringIndices(rows *sql.Rows) error {
+func handleNameStringIndices(rows *sql.Rows, w rowWriter, p *progress) error {
 	var dataSourceID, nameStringID, taxonID string
 	var url, globalID, localID, nomenclaturalCodeID, rank sql.NullString
 	var acceptedTaxonID sql.NullString
 	var classificationPath, classificationPathIDs sql.NullString
 	var classificationPathRanks sql.NullString
-	file, err := d.csvFile("name_string_indices")
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	w := csv.NewWriter(file)
-	err = w.Write([]string{"data_source_id", "name_string_id", "url",
-		"taxon_id", "global_id", "local_id", "nomenclatural_code_id", "rank",
-		"accepted_taxon_id", "classification_path", "classification_path_ids",
-		"classification_path_ranks"})
-	if err != nil {
-		return err
-	}
 
-	var count int64
 	for rows.Next() {
-		count++
-		if count%100_000 == 0 {
-			fmt.Printf("\r%s", strings.Repeat(" ", 35))
-			fmt.Printf("\rDownloaded %s name indices to a CSV file", humanize.Comma(count))
-		}
+		p.inc()
 		err := rows.Scan(&dataSourceID, &nameStringID, &url, &taxonID,
 			&globalID, &localID, &nomenclaturalCodeID, &rank, &acceptedTaxonID,
 			&classificationPath, &classificationPathIDs,
@@ -303,14 +328,7 @@ func (d *dumpio) handleNameStringIndices(rows *sql.Rows) error {
 			return err
 		}
 	}
-	w.Flush()
-	file.Sync()
-	fmt.Printf("\r%s", strings.Repeat(" ", 35))
-	fmt.Printf(
-		"\rDownloaded %s name indices to a CSV file\n",
-		humanize.Comma(count),
-	)
-	return nil
+	return rows.Err()
 }
 
 func removeNewLines(data sql.NullString) string {
@@ -321,7 +339,14 @@ func removeNewLines(data sql.NullString) string {
 func (d *dumpio) dumpTableVernacularStrings() error {
 	slog.Info("Create vernacular_strings.csv")
 	q := "SELECT id, name FROM vernacular_strings"
-	rows, err := d.db.Query(q)
+	if d.isIncremental() {
+		q += `
+					WHERE id IN (
+						SELECT vernacular_string_id
+							FROM vernacular_string_indices
+							WHERE data_source_id IN (` + d.sourceIDs() + `))`
+	}
+	rows, err := d.conn.QueryContext(context.Background(), q)
 	if err != nil {
 		return err
 	}
@@ -336,15 +361,10 @@ func (d *dumpio) dumpTableVernacularStrings() error {
 func (d *dumpio) handleVernacularStrings(rows *sql.Rows) error {
 	var id string
 	var name string
-	file, err := d.csvFile("vernacular_strings")
+	w, err := d.csvFile("vernacular_strings", dump.Headers["vernacular_strings"])
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	w := csv.NewWriter(file)
-	if err = w.Write([]string{"id", "name"}); err != nil {
-		return err
-	}
 
 	var count int64
 	for rows.Next() {
@@ -359,9 +379,11 @@ func (d *dumpio) handleVernacularStrings(rows *sql.Rows) error {
 			return err
 		}
 	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
 	fmt.Printf("Downloaded %s vernaculars to a CSV file\n", humanize.Comma(count))
-	w.Flush()
-	return file.Sync()
+	return d.saveCSV(w)
 }
 
 func (d *dumpio) dumpTableVernacularStringIndices() error {
@@ -370,8 +392,12 @@ func (d *dumpio) dumpTableVernacularStringIndices() error {
 					vernacular_string_id, language, locality,
 					country_code
 					FROM vernacular_string_indices`
+	if d.isIncremental() {
+		q += `
+					WHERE data_source_id IN (` + d.sourceIDs() + `)`
+	}
 
-	rows, err := d.db.Query(q)
+	rows, err := d.conn.QueryContext(context.Background(), q)
 	if err != nil {
 		return err
 	}
@@ -387,15 +413,9 @@ func (d *dumpio) dumpTableVernacularStringIndices() error {
 func (d *dumpio) handleVernacularStringIndices(rows *sql.Rows) error {
 	var dataSourceID, taxonID, vernacularStringID string
 	var language, locality, countryCode sql.NullString
-	file, err := d.csvFile("vernacular_string_indices")
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	w := csv.NewWriter(file)
-	err = w.Write([]string{"data_source_id", "taxon_id", "vernacular_string_id",
-		"language", "locality", "country_code"})
+	w, err := d.csvFile(
+		"vernacular_string_indices", dump.Headers["vernacular_string_indices"],
+	)
 	if err != nil {
 		return err
 	}
@@ -421,8 +441,10 @@ func (d *dumpio) handleVernacularStringIndices(rows *sql.Rows) error {
 			return err
 		}
 	}
-	w.Flush()
+	if err = rows.Err(); err != nil {
+		return err
+	}
 	fmt.Printf("\r%s", strings.Repeat(" ", 35))
 	fmt.Printf("\rDownloaded %s verncular indices to a CSV file\n", humanize.Comma(count))
-	return file.Sync()
+	return d.saveCSV(w)
 }
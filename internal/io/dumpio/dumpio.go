@@ -1,12 +1,19 @@
 package dumpio
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
+	"github.com/gnames/gnfmt"
 	"github.com/gnames/gnidump/internal/ent/dump"
+	gnidump "github.com/gnames/gnidump/pkg"
 	"github.com/gnames/gnidump/pkg/config"
 	"github.com/gnames/gnsys"
 
@@ -16,11 +23,42 @@ import (
 type dumpio struct {
 	cfg config.Config
 	db  *sql.DB
+
+	// conns are connections that keep identical consistent snapshot
+	// transactions. Large tables are read through all of them in parallel.
+	conns []*sql.Conn
+
+	// conn is the first of conns. Small tables are read through it.
+	conn *sql.Conn
+
+	// snapshotAt is the time when the snapshot was taken.
+	snapshotAt time.Time
+
+	// files describe CSV files created by the dump.
+	files []dump.File
+
+	// stats are cached statistics of name-string indices.
+	stats []nsiStat
+
+	// state is the progress of the dump.
+	state *dumpState
+
+	// stateMu protects the state from concurrent access.
+	stateMu sync.Mutex
 }
 
 func New(cfg config.Config) (dump.Dumper, error) {
 	var err error
 	res := dumpio{cfg: cfg}
+
+	_, err = dump.CompressionExt(cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DumpChunkSize < 1 {
+		return nil, fmt.Errorf("dump chunk size must be positive")
+	}
+
 	res.db, err = res.initDb()
 	if err != nil {
 		return nil, err
@@ -39,36 +77,96 @@ func (d *dumpio) Dump() error {
 
 	slog.Info("Dumping data from GNI to CSV files.")
 
-	err := d.updateDataSourcesDate()
-	if err != nil {
+	// manifest of a previous dump does not describe the new files
+	err := os.Remove(filepath.Join(d.cfg.DumpDir, dump.ManifestFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
-	err = d.dumpTableDataSources()
-	if err != nil {
-		return err
+
+	if d.cfg.SyncDates {
+		slog.Info("Updating data_sources dates in GNI database")
+		err = d.updateDataSourcesDate()
+		if err != nil {
+			return err
+		}
 	}
-	err = d.dumpTableNameStrings()
+
+	ctx := context.Background()
+	err = d.startSnapshot(ctx)
 	if err != nil {
+		slog.Error("Cannot start consistent snapshot", "error", err)
 		return err
 	}
-	err = d.dumpTableNameStringIndices()
+	defer d.endSnapshot(ctx)
+	slog.Info("Reading GNI snapshot", "snapshot", d.snapshotAt.Format(time.RFC3339))
+
+	err = d.initState()
 	if err != nil {
+		slog.Error("Cannot initialize dump state", "error", err)
 		return err
 	}
-	err = d.dumpTableVernacularStrings()
+
+	tables := []struct {
+		name string
+		fn   func() error
+	}{
+		{"data_sources", d.dumpTableDataSources},
+		{"name_strings", d.dumpTableNameStrings},
+		{"name_string_indices", d.dumpTableNameStringIndices},
+		{"vernacular_strings", d.dumpTableVernacularStrings},
+		{"vernacular_string_indices", d.dumpTableVernacularStringIndices},
+	}
+	for _, v := range tables {
+		if err = d.dumpTable(v.name, v.fn); err != nil {
+			return err
+		}
+	}
+
+	err = d.saveManifest()
 	if err != nil {
+		slog.Error("Cannot save dump manifest", "error", err)
 		return err
 	}
-	err = d.dumpTableVernacularStringIndices()
-	if err != nil {
+	if err = d.removeState(); err != nil {
 		return err
 	}
 
 	slog.Info("CSV dump is created")
+	err = d.endSnapshot(ctx)
+	if err != nil {
+		return err
+	}
 	return d.db.Close()
 }
 
-func (d *dumpio) csvFile(f string) (*os.File, error) {
-	path := filepath.Join(d.cfg.DumpDir, f+".csv")
-	return os.Create(path)
+// saveCSV closes a CSV file and adds its description to the manifest.
+func (d *dumpio) saveCSV(c *csvFile) error {
+	entry, err := c.Close()
+	if err != nil {
+		return err
+	}
+	d.files = append(d.files, entry)
+	return d.tableDone(entry)
+}
+
+// saveManifest writes description of the dump to the dump directory.
+// It is the last file written by the dump, so a dump without a manifest
+// is incomplete.
+func (d *dumpio) saveManifest() error {
+	m := dump.Manifest{
+		GnidumpVersion:   gnidump.Version,
+		SchemaVersion:    dump.SchemaVersion,
+		SnapshotAt:       d.state.SnapshotAt,
+		ResumedSnapshots: d.state.ResumedSnapshots,
+		Sources:          d.state.Sources,
+		CreatedAt:        time.Now().UTC(),
+		Files:            d.files,
+	}
+	enc := gnfmt.GNjson{Pretty: true}
+	bs, err := enc.Encode(m)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(d.cfg.DumpDir, dump.ManifestFile)
+	return os.WriteFile(path, bs, 0644)
 }
@@ -0,0 +1,117 @@
+package dumpio
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+)
+
+// startSnapshot opens read-only REPEATABLE READ transactions with a
+// consistent snapshot of the database on JobsNum connections. All tables
+// are read within these transactions, so CSV files agree with each other
+// even if the GNI database is modified during the dump.
+//
+// Snapshots of several connections are identical only if the database is
+// locked with FLUSH TABLES WITH READ LOCK while transactions start. The lock
+// blocks writers of the database and requires RELOAD privilege, so it is
+// used only when DumpLockTables is set. Otherwise, or if the lock fails,
+// the dump reads all tables with one connection.
+func (d *dumpio) startSnapshot(ctx context.Context) error {
+	connsNum := max(d.cfg.JobsNum, 1)
+	if connsNum > 1 && !d.cfg.DumpLockTables {
+		slog.Info("Dumping with one connection, use --lock-tables " +
+			"to read large tables in parallel")
+		connsNum = 1
+	}
+
+	var lock *sql.Conn
+	var err error
+	if connsNum > 1 {
+		lock, err = d.lockTables(ctx)
+		if err != nil {
+			slog.Warn(
+				"Cannot synchronize snapshots of several connections, "+
+					"dumping with one connection",
+				"error", err,
+			)
+			connsNum = 1
+		}
+	}
+
+	for range connsNum {
+		var conn *sql.Conn
+		conn, err = d.snapshotConn(ctx)
+		if err != nil {
+			break
+		}
+		d.conns = append(d.conns, conn)
+	}
+	if lock != nil {
+		if _, lockErr := lock.ExecContext(ctx, "UNLOCK TABLES"); err == nil {
+			err = lockErr
+		}
+		lock.Close()
+	}
+	if err != nil {
+		d.endSnapshot(ctx)
+		return err
+	}
+
+	d.conn = d.conns[0]
+	err = d.conn.QueryRowContext(ctx, "SELECT UTC_TIMESTAMP()").Scan(&d.snapshotAt)
+	if err != nil {
+		d.endSnapshot(ctx)
+		return err
+	}
+	d.snapshotAt = d.snapshotAt.UTC()
+	return nil
+}
+
+// lockTables prevents writes to the database until UNLOCK TABLES is called
+// on the returned connection.
+func (d *dumpio) lockTables(ctx context.Context) (*sql.Conn, error) {
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// snapshotConn returns a connection with an open snapshot transaction.
+func (d *dumpio) snapshotConn(ctx context.Context) (*sql.Conn, error) {
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	qs := []string{
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY",
+	}
+	for _, q := range qs {
+		if _, err = conn.ExecContext(ctx, q); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// endSnapshot finishes snapshot transactions and releases their
+// connections. It is safe to call it more than once.
+func (d *dumpio) endSnapshot(ctx context.Context) error {
+	var err error
+	for _, conn := range d.conns {
+		if _, commitErr := conn.ExecContext(ctx, "COMMIT"); err == nil {
+			err = commitErr
+		}
+		conn.Close()
+	}
+	d.conns = nil
+	d.conn = nil
+	return err
+}
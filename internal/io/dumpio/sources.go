@@ -0,0 +1,114 @@
+package dumpio
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// updatedAtExpr is the date of the latest harvest of a data-source. It is
+// the same value that updateDataSourcesDate would save to GNI database.
+const updatedAtExpr = `COALESCE(
+	 	  			(SELECT nsi.updated_at
+	 	  				FROM name_string_indices nsi
+	 	  				WHERE nsi.data_source_id = ds.id LIMIT 1),
+	 	  			ds.updated_at
+	 	  		)`
+
+// selectSources returns IDs of data-sources of an incremental dump. They
+// are data-sources given by DumpSources setting and data-sources harvested
+// after DumpSince date. The result is empty for a full dump.
+func (d *dumpio) selectSources() ([]int, error) {
+	if d.cfg.DumpSince.IsZero() && len(d.cfg.DumpSources) == 0 {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	var known []int
+	var changed []int
+	q := "SELECT ds.id, " + updatedAtExpr + " >= ? FROM data_sources ds"
+	rows, err := d.conn.QueryContext(ctx, q, d.cfg.DumpSince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var isChanged sql.NullBool
+		if err = rows.Scan(&id, &isChanged); err != nil {
+			return nil, err
+		}
+		known = append(known, id)
+		if !d.cfg.DumpSince.IsZero() && isChanged.Bool {
+			changed = append(changed, id)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !d.cfg.DumpSince.IsZero() {
+		slog.Info("Found data-sources changed since the date",
+			"since", d.cfg.DumpSince.Format(time.DateOnly),
+			"sources", len(changed))
+	}
+
+	res := changed
+	for _, id := range d.cfg.DumpSources {
+		if !slices.Contains(known, id) {
+			return nil, fmt.Errorf("data-source %d does not exist in GNI", id)
+		}
+		res = append(res, id)
+	}
+	slices.Sort(res)
+	res = slices.Compact(res)
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf(
+			"no data-sources changed since %s",
+			d.cfg.DumpSince.Format(time.DateOnly),
+		)
+	}
+	return res, nil
+}
+
+// isIncremental is true when the dump contains only some of data-sources.
+func (d *dumpio) isIncremental() bool {
+	return len(d.state.Sources) > 0
+}
+
+// sourceIDs returns a comma-separated list of IDs of data-sources of an
+// incremental dump to be used in SQL queries.
+func (d *dumpio) sourceIDs() string {
+	res := make([]string, len(d.state.Sources))
+	for i, v := range d.state.Sources {
+		res[i] = strconv.Itoa(v)
+	}
+	return strings.Join(res, ",")
+}
+
+// sourceStats returns statistics of name-string indices of data-sources
+// that belong to the dump.
+func (d *dumpio) sourceStats() ([]nsiStat, error) {
+	stats, err := d.nsiStats()
+	if err != nil {
+		return nil, err
+	}
+	if !d.isIncremental() {
+		return stats, nil
+	}
+
+	var res []nsiStat
+	for _, v := range stats {
+		if slices.Contains(d.state.Sources, v.dataSourceID) {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,202 @@
+package dumpio
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gnames/gnfmt"
+	"github.com/gnames/gnidump/internal/ent/dump"
+)
+
+// stateFile keeps the progress of an unfinished dump in the dump directory.
+const stateFile = "dump_state.json"
+
+// dumpState is the progress of a dump. It allows to resume the dump after
+// a failure.
+type dumpState struct {
+	// SnapshotAt is the snapshot time of the first run of the dump.
+	SnapshotAt time.Time `json:"snapshotAt"`
+
+	// ResumedSnapshots are snapshot times of resumed runs.
+	ResumedSnapshots []time.Time `json:"resumedSnapshots,omitempty"`
+
+	// Sources are IDs of data-sources of an incremental dump. A resumed
+	// dump keeps data-sources selected by the first run.
+	Sources []int `json:"sources,omitempty"`
+
+	// Tables is the progress of every table by its name.
+	Tables map[string]*tableState `json:"tables"`
+}
+
+// tableState is the progress of a table dump.
+type tableState struct {
+	// File describes the finished CSV file of the table. It is nil until
+	// the table is dumped completely.
+	File *dump.File `json:"file,omitempty"`
+
+	// Chunks is the plan of a chunked table. The plan is saved, so
+	// a resumed dump reads exactly the same key ranges.
+	Chunks []chunk `json:"chunks,omitempty"`
+
+	// Done contains numbers of rows of completed chunks by the index of
+	// the chunk.
+	Done map[int]int64 `json:"done,omitempty"`
+}
+
+// initState starts a new dump state or, if DumpResume is set, loads the
+// state of the previous unfinished dump. Files of a resumed dump come from
+// different snapshots, so resume requires DumpMixedSnapshots.
+func (d *dumpio) initState() error {
+	if d.cfg.DumpResume {
+		st, err := d.loadState()
+		if err != nil {
+			return err
+		}
+		if st != nil && !d.cfg.DumpMixedSnapshots {
+			return fmt.Errorf(
+				"resumed dump would mix snapshots %s and %s, "+
+					"use --mixed-snapshots to accept it",
+				st.SnapshotAt.Format(time.RFC3339),
+				d.snapshotAt.Format(time.RFC3339),
+			)
+		}
+		if st != nil {
+			st.ResumedSnapshots = append(st.ResumedSnapshots, d.snapshotAt)
+			d.state = st
+			slog.Info("Resuming dump",
+				"first-snapshot", st.SnapshotAt.Format(time.RFC3339))
+			if !d.cfg.DumpSince.IsZero() || len(d.cfg.DumpSources) > 0 {
+				slog.Warn("Resumed dump ignores new data-sources selection",
+					"sources", st.Sources)
+			}
+			return d.saveState()
+		}
+		slog.Warn("Nothing to resume, starting a new dump")
+	}
+
+	err := os.RemoveAll(filepath.Join(d.cfg.DumpDir, "parts"))
+	if err != nil {
+		return err
+	}
+	sources, err := d.selectSources()
+	if err != nil {
+		return err
+	}
+	if len(sources) > 0 {
+		slog.Info("Creating incremental dump", "sources", sources)
+	}
+	d.state = &dumpState{
+		SnapshotAt: d.snapshotAt,
+		Sources:    sources,
+		Tables:     make(map[string]*tableState),
+	}
+	return d.saveState()
+}
+
+// loadState reads the state of a previous dump. It returns nil if there
+// is no state.
+func (d *dumpio) loadState() (*dumpState, error) {
+	bs, err := os.ReadFile(filepath.Join(d.cfg.DumpDir, stateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var res dumpState
+	enc := gnfmt.GNjson{}
+	if err = enc.Decode(bs, &res); err != nil {
+		return nil, err
+	}
+	if res.Tables == nil {
+		res.Tables = make(map[string]*tableState)
+	}
+	return &res, nil
+}
+
+// saveState writes the state to the dump directory. The file is replaced
+// atomically, so a crash does not leave a broken state behind.
+func (d *dumpio) saveState() error {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+
+	enc := gnfmt.GNjson{Pretty: true}
+	bs, err := enc.Encode(d.state)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(d.cfg.DumpDir, stateFile)
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, bs, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// removeState deletes the state of a finished dump.
+func (d *dumpio) removeState() error {
+	err := os.Remove(filepath.Join(d.cfg.DumpDir, stateFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// tableState returns the progress of a table, creating it if necessary.
+func (d *dumpio) tableState(table string) *tableState {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+
+	ts, ok := d.state.Tables[table]
+	if !ok {
+		ts = &tableState{}
+		d.state.Tables[table] = ts
+	}
+	return ts
+}
+
+// dumpTable runs the dump of a table unless the table was finished by
+// a previous run and its file is intact.
+func (d *dumpio) dumpTable(table string, fn func() error) error {
+	ts := d.tableState(table)
+	if ts.File != nil {
+		err := ts.File.Verify(d.cfg.DumpDir)
+		if err == nil {
+			slog.Info("Skipping table finished by a previous run", "table", table)
+			d.files = append(d.files, *ts.File)
+			return nil
+		}
+		slog.Warn("Dumping table again", "table", table, "reason", err)
+		d.stateMu.Lock()
+		ts.File = nil
+		d.stateMu.Unlock()
+	}
+	return fn()
+}
+
+// chunkDone records a completed chunk of a table.
+func (d *dumpio) chunkDone(table string, idx int, rows int64) error {
+	ts := d.tableState(table)
+	d.stateMu.Lock()
+	if ts.Done == nil {
+		ts.Done = make(map[int]int64)
+	}
+	ts.Done[idx] = rows
+	d.stateMu.Unlock()
+	return d.saveState()
+}
+
+// tableDone records a finished CSV file of a table.
+func (d *dumpio) tableDone(f dump.File) error {
+	ts := d.tableState(f.Table)
+	d.stateMu.Lock()
+	ts.File = &f
+	ts.Chunks = nil
+	ts.Done = nil
+	d.stateMu.Unlock()
+	return d.saveState()
+}
@@ -0,0 +1,110 @@
+package kvio
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gnames/gnidump/internal/ent/kv"
+)
+
+// badgerKV is a key-value store based on BadgerDB.
+type badgerKV struct {
+	dir string
+	kv  *badger.DB
+}
+
+func newBadger(dir string) *badgerKV {
+	return &badgerKV{dir: dir}
+}
+
+// Open opens a key-value store.
+func (k *badgerKV) Open() error {
+	if k.kv != nil {
+		slog.Warn("key-value store is not nil")
+	}
+	options := badger.DefaultOptions(k.dir)
+	options.Logger = nil
+
+	bdb, err := badger.Open(options)
+	if err != nil {
+		return err
+	}
+	k.kv = bdb
+	return nil
+}
+
+// Close closes a key-value store.
+func (k *badgerKV) Close() error {
+	if k.kv == nil {
+		slog.Warn("key-value store is nil")
+		return nil
+	}
+	err := k.kv.Close()
+	k.kv = nil
+	return err
+}
+
+// Reset removes all data from the store.
+func (k *badgerKV) Reset() error {
+	if k.kv == nil {
+		err := errors.New("key-value store is not open")
+		return err
+	}
+	return k.kv.DropAll()
+}
+
+// NewBatch returns a writer that saves key-value pairs in batches. Badger
+// commits the batch when it becomes too big for one transaction.
+func (k *badgerKV) NewBatch() (kv.Batch, error) {
+	if k.kv == nil {
+		err := errors.New("key-value store is not open")
+		return nil, err
+	}
+	return &badgerBatch{wb: k.kv.NewWriteBatch()}, nil
+}
+
+// GetValue returns a value for a given key.
+func (k *badgerKV) GetValue(key []byte) ([]byte, error) {
+	res, err := k.GetValues([][]byte{key})
+	if err != nil {
+		return nil, err
+	}
+	return res[0], nil
+}
+
+// GetValues returns values for given keys using one read transaction.
+func (k *badgerKV) GetValues(keys [][]byte) ([][]byte, error) {
+	if k.kv == nil {
+		err := errors.New("key-value store is not open")
+		return nil, err
+	}
+	txn := k.kv.NewTransaction(false)
+	defer txn.Discard()
+
+	res := make([][]byte, len(keys))
+	for i, key := range keys {
+		val, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if res[i], err = val.ValueCopy(nil); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+type badgerBatch struct {
+	wb *badger.WriteBatch
+}
+
+func (b *badgerBatch) Set(key, value []byte) error {
+	return b.wb.Set(key, value)
+}
+
+func (b *badgerBatch) Commit() error {
+	return b.wb.Flush()
+}
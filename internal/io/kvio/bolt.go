@@ -0,0 +1,148 @@
+package kvio
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"slices"
+
+	"github.com/gnames/gnidump/internal/ent/kv"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltBatchSize is the number of key-value pairs saved by one write
+// transaction of bbolt.
+const boltBatchSize = 100_000
+
+var boltBucket = []byte("kv")
+
+// boltKV is a key-value store based on bbolt.
+type boltKV struct {
+	path string
+	db   *bolt.DB
+}
+
+func newBolt(dir string) *boltKV {
+	return &boltKV{path: filepath.Join(dir, "kv.bolt")}
+}
+
+// Open opens a key-value store.
+func (k *boltKV) Open() error {
+	db, err := bolt.Open(k.path, 0644, &bolt.Options{NoFreelistSync: true})
+	if err != nil {
+		return err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+	k.db = db
+	return nil
+}
+
+// Close closes a key-value store.
+func (k *boltKV) Close() error {
+	if k.db == nil {
+		return nil
+	}
+	err := k.db.Close()
+	k.db = nil
+	return err
+}
+
+// Reset removes all data from the store.
+func (k *boltKV) Reset() error {
+	if k.db == nil {
+		err := errors.New("key-value store is not open")
+		return err
+	}
+	return k.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(boltBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(boltBucket)
+		return err
+	})
+}
+
+// NewBatch returns a writer that saves key-value pairs in batches. Pairs
+// are sorted before saving, because bbolt writes sorted keys much faster.
+func (k *boltKV) NewBatch() (kv.Batch, error) {
+	if k.db == nil {
+		err := errors.New("key-value store is not open")
+		return nil, err
+	}
+	res := boltBatch{
+		db:   k.db,
+		recs: make([]kv.Record, 0, boltBatchSize),
+	}
+	return &res, nil
+}
+
+// GetValue returns a value for a given key.
+func (k *boltKV) GetValue(key []byte) ([]byte, error) {
+	res, err := k.GetValues([][]byte{key})
+	if err != nil {
+		return nil, err
+	}
+	return res[0], nil
+}
+
+// GetValues returns values for given keys using one read transaction.
+func (k *boltKV) GetValues(keys [][]byte) ([][]byte, error) {
+	if k.db == nil {
+		err := errors.New("key-value store is not open")
+		return nil, err
+	}
+	res := make([][]byte, len(keys))
+	err := k.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltBucket)
+		for i, key := range keys {
+			if val := b.Get(key); val != nil {
+				res[i] = bytes.Clone(val)
+			}
+		}
+		return nil
+	})
+	return res, err
+}
+
+type boltBatch struct {
+	db   *bolt.DB
+	recs []kv.Record
+}
+
+func (b *boltBatch) Set(key, value []byte) error {
+	b.recs = append(b.recs, kv.Record{
+		Key:   bytes.Clone(key),
+		Value: bytes.Clone(value),
+	})
+	if len(b.recs) < boltBatchSize {
+		return nil
+	}
+	return b.Commit()
+}
+
+func (b *boltBatch) Commit() error {
+	if len(b.recs) == 0 {
+		return nil
+	}
+	slices.SortFunc(b.recs, func(a, b kv.Record) int {
+		return bytes.Compare(a.Key, b.Key)
+	})
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(boltBucket)
+		for _, v := range b.recs {
+			if err := bkt.Put(v.Key, v.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	b.recs = b.recs[:0]
+	return err
+}
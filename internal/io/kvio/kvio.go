@@ -1,23 +1,19 @@
 package kvio
 
 import (
-	"errors"
+	"fmt"
 	"log/slog"
 
-	"github.com/dgraph-io/badger/v2"
 	"github.com/gnames/gnidump/internal/ent/kv"
 	"github.com/gnames/gnsys"
 )
 
-type kvio struct {
-	dir string
-	kv  *badger.DB
-}
-
-// New returns a new instance of kvio.
-func New(dir string) (kv.KeyVal, error) {
-	res := kvio{
-		dir: dir,
+// New returns a new key-value store of the given type. Stores that keep
+// data on disk use dir. Data in dir is kept, so the store can be reused by
+// later runs of gnidump.
+func New(store, dir string) (kv.KeyVal, error) {
+	if store == kv.Memory {
+		return newMemory(), nil
 	}
 
 	err := gnsys.MakeDir(dir)
@@ -26,63 +22,15 @@ func New(dir string) (kv.KeyVal, error) {
 		return nil, err
 	}
 
-	err = gnsys.CleanDir(dir)
-	if err != nil {
-		slog.Error("Cannot reset  KeyValue", "error", err, "dir", dir)
-		return nil, err
-	}
-
-	return &res, err
-}
-
-// Open opens a key-value store.
-func (k *kvio) Open() error {
-	if k.kv != nil {
-		slog.Warn("key-value store is not nil")
-	}
-	options := badger.DefaultOptions(k.dir)
-	options.Logger = nil
-
-	bdb, err := badger.Open(options)
-	if err != nil {
-		return err
-	}
-	k.kv = bdb
-	return nil
-}
-
-// Close closes a key-value store.
-func (k *kvio) Close() error {
-	if k.kv == nil {
-		slog.Warn("key-value store is nil")
-		return nil
-	}
-	err := k.kv.Close()
-	k.kv = nil
-	return err
-}
-
-// GetTransaction returns a transaction object.
-func (k *kvio) GetTransaction() (*badger.Txn, error) {
-	if k.kv == nil {
-		err := errors.New("key-value store is not open")
-		return nil, err
-	}
-	trx := k.kv.NewTransaction(true)
-	return trx, nil
-}
-
-// GetValue returns a value for a given key.
-func (k *kvio) GetValue(key []byte) ([]byte, error) {
-	txn := k.kv.NewTransaction(false)
-	defer txn.Commit()
-	val, err := txn.Get(key)
-	if err == badger.ErrKeyNotFound {
-		slog.Warn("Cannot find key", "key", key)
-		return nil, nil
-	} else if err != nil {
-		return nil, err
+	switch store {
+	case "", kv.Badger:
+		return newBadger(dir), nil
+	case kv.Bolt:
+		return newBolt(dir), nil
+	default:
+		return nil, fmt.Errorf(
+			"unknown key-value store '%s', use %s, %s or %s",
+			store, kv.Badger, kv.Bolt, kv.Memory,
+		)
 	}
-	var res []byte
-	return val.ValueCopy(res)
 }
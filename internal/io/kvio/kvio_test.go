@@ -0,0 +1,108 @@
+package kvio
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/gnames/gnidump/internal/ent/kv"
+)
+
+func TestStores(t *testing.T) {
+	tests := []struct {
+		msg   string
+		store string
+	}{
+		{"badger", kv.Badger},
+		{"bolt", kv.Bolt},
+		{"memory", kv.Memory},
+	}
+
+	for _, v := range tests {
+		t.Run(v.msg, func(t *testing.T) {
+			s, err := New(v.store, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			testStore(t, s)
+		})
+	}
+}
+
+func testStore(t *testing.T, s kv.KeyVal) {
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make([][]byte, 1000)
+	b, err := s.NewBatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range keys {
+		keys[i] = fmt.Appendf(nil, "key%d", i)
+		if err = b.Set(keys[i], fmt.Appendf(nil, "val%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := s.GetValue([]byte("key42"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, []byte("val42")) {
+		t.Errorf("GetValue: got '%s', want 'val42'", val)
+	}
+	val, err = s.GetValue([]byte("nokey"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != nil {
+		t.Errorf("GetValue of missing key: got '%s', want nil", val)
+	}
+
+	vals, err := s.GetValues(
+		[][]byte{[]byte("key0"), []byte("nokey"), []byte("key999")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]byte{[]byte("val0"), nil, []byte("val999")}
+	for i := range want {
+		if !bytes.Equal(vals[i], want[i]) || (vals[i] == nil) != (want[i] == nil) {
+			t.Errorf("GetValues %d: got '%s', want '%s'", i, vals[i], want[i])
+		}
+	}
+
+	// data stays after the store is reopened
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	val, err = s.GetValue([]byte("key7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, []byte("val7")) {
+		t.Errorf("GetValue after reopen: got '%s', want 'val7'", val)
+	}
+
+	if err = s.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	val, err = s.GetValue([]byte("key7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != nil {
+		t.Errorf("GetValue after reset: got '%s', want nil", val)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,76 @@
+package kvio
+
+import (
+	"sync"
+
+	"github.com/gnames/gnidump/internal/ent/kv"
+)
+
+// memoryKV is a key-value store that keeps data in a map. The data stays
+// after Close, so the store can be reopened by later stages of a build.
+type memoryKV struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+func newMemory() *memoryKV {
+	return &memoryKV{data: make(map[string][]byte)}
+}
+
+// Open opens a key-value store.
+func (k *memoryKV) Open() error {
+	return nil
+}
+
+// Close closes a key-value store.
+func (k *memoryKV) Close() error {
+	return nil
+}
+
+// Reset removes all data from the store.
+func (k *memoryKV) Reset() error {
+	k.mu.Lock()
+	k.data = make(map[string][]byte)
+	k.mu.Unlock()
+	return nil
+}
+
+// NewBatch returns a writer that saves key-value pairs directly to the map.
+func (k *memoryKV) NewBatch() (kv.Batch, error) {
+	return &memoryBatch{kv: k}, nil
+}
+
+// GetValue returns a value for a given key.
+func (k *memoryKV) GetValue(key []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.data[string(key)], nil
+}
+
+// GetValues returns values for given keys.
+func (k *memoryKV) GetValues(keys [][]byte) ([][]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	res := make([][]byte, len(keys))
+	for i, key := range keys {
+		res[i] = k.data[string(key)]
+	}
+	return res, nil
+}
+
+type memoryBatch struct {
+	kv *memoryKV
+}
+
+func (b *memoryBatch) Set(key, value []byte) error {
+	val := make([]byte, len(value))
+	copy(val, value)
+	b.kv.mu.Lock()
+	b.kv.data[string(key)] = val
+	b.kv.mu.Unlock()
+	return nil
+}
+
+func (b *memoryBatch) Commit() error {
+	return nil
+}
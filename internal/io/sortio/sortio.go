@@ -0,0 +1,234 @@
+// Package sortio sorts large sets of CSV rows by a key field. Rows are
+// sorted in chunks of bounded size, the chunks are saved to temporary files,
+// and the files are merged when rows are read back.
+package sortio
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/gnames/gnsys"
+)
+
+// Sorter collects rows and sorts them by the field at the key position.
+// Keys are compared by their length first and then lexicographically, so
+// numeric IDs without leading zeroes are sorted by their value. Only
+// chunkSize rows are kept in memory.
+type Sorter struct {
+	dir       string
+	key       int
+	chunkSize int
+	rows      [][]string
+	runs      []string
+}
+
+// New creates a Sorter that keeps its temporary files in a new directory
+// inside of dir.
+func New(dir string, key, chunkSize int) (*Sorter, error) {
+	if chunkSize < 1 {
+		return nil, fmt.Errorf("chunk size must be positive, got %d", chunkSize)
+	}
+	if err := gnsys.MakeDir(dir); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(dir, "sort-")
+	if err != nil {
+		return nil, err
+	}
+	res := Sorter{
+		dir:       tmp,
+		key:       key,
+		chunkSize: chunkSize,
+		rows:      make([][]string, 0, chunkSize),
+	}
+	return &res, nil
+}
+
+// Add adds a row to the Sorter. When the chunk is full, it is sorted and
+// saved to a file.
+func (s *Sorter) Add(row []string) error {
+	if s.key >= len(row) {
+		return fmt.Errorf("row has no field %d: %v", s.key, row)
+	}
+	s.rows = append(s.rows, row)
+	if len(s.rows) < s.chunkSize {
+		return nil
+	}
+	return s.flush()
+}
+
+// Sort finishes collecting rows and returns a reader of sorted rows.
+func (s *Sorter) Sort() (*Reader, error) {
+	if err := s.flush(); err != nil {
+		return nil, err
+	}
+	res := Reader{key: s.key}
+	for _, v := range s.runs {
+		f, err := os.Open(v)
+		if err != nil {
+			res.Close()
+			return nil, err
+		}
+		r := csv.NewReader(bufio.NewReaderSize(f, 1<<20))
+		r.FieldsPerRecord = -1
+		rn := &run{r: r, f: f}
+		res.files = append(res.files, f)
+		ok, err := rn.next(s.key)
+		if err != nil {
+			res.Close()
+			return nil, err
+		}
+		if ok {
+			res.h = append(res.h, rn)
+		}
+	}
+	heap.Init(&res.h)
+	return &res, nil
+}
+
+// Close removes temporary files of the Sorter.
+func (s *Sorter) Close() error {
+	s.rows = nil
+	return os.RemoveAll(s.dir)
+}
+
+// flush sorts rows in memory and saves them to a new file.
+func (s *Sorter) flush() error {
+	if len(s.rows) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(s.rows, func(a, b []string) int {
+		return Compare(a[s.key], b[s.key])
+	})
+
+	path := filepath.Join(s.dir, fmt.Sprintf("run-%05d.csv", len(s.runs)))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(f, 1<<20)
+	w := csv.NewWriter(bw)
+	if err = w.WriteAll(s.rows); err != nil {
+		f.Close()
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	s.runs = append(s.runs, path)
+	s.rows = s.rows[:0]
+	return nil
+}
+
+// Compare compares two keys in the order used by Sorter. It returns -1, 0
+// or 1.
+func Compare(a, b string) int {
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Reader reads sorted rows by merging files of a Sorter.
+type Reader struct {
+	key   int
+	h     runHeap
+	files []*os.File
+}
+
+// Read returns the next row in the order of keys. It returns io.EOF when
+// all rows are read.
+func (r *Reader) Read() ([]string, error) {
+	if len(r.h) == 0 {
+		return nil, io.EOF
+	}
+	rn := r.h[0]
+	res := rn.row
+	ok, err := rn.next(r.key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		heap.Fix(&r.h, 0)
+	} else {
+		heap.Pop(&r.h)
+	}
+	return res, nil
+}
+
+// Close closes files of the Reader.
+func (r *Reader) Close() error {
+	var res error
+	for _, v := range r.files {
+		if err := v.Close(); err != nil && res == nil {
+			res = err
+		}
+	}
+	r.files = nil
+	r.h = nil
+	return res
+}
+
+// run is a sorted file with its current row.
+type run struct {
+	r   *csv.Reader
+	f   *os.File
+	row []string
+	key string
+}
+
+func (rn *run) next(key int) (bool, error) {
+	row, err := rn.r.Read()
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if key >= len(row) {
+		return false, fmt.Errorf("row in %s has no field %d", rn.f.Name(), key)
+	}
+	rn.row = row
+	rn.key = row[key]
+	return true, nil
+}
+
+// runHeap keeps runs ordered by keys of their current rows.
+type runHeap []*run
+
+func (h runHeap) Len() int { return len(h) }
+
+func (h runHeap) Less(i, j int) bool {
+	return Compare(h[i].key, h[j].key) < 0
+}
+
+func (h runHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *runHeap) Push(x any) { *h = append(*h, x.(*run)) }
+
+func (h *runHeap) Pop() any {
+	old := *h
+	n := len(old)
+	res := old[n-1]
+	*h = old[:n-1]
+	return res
+}
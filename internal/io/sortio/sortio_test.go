@@ -0,0 +1,105 @@
+package sortio
+
+import (
+	"io"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		msg  string
+		a, b string
+		want int
+	}{
+		{"equal", "12", "12", 0},
+		{"shorter first", "9", "10", -1},
+		{"longer last", "100", "99", 1},
+		{"same length", "12", "13", -1},
+		{"empty", "", "0", -1},
+	}
+
+	for _, v := range tests {
+		if res := Compare(v.a, v.b); res != v.want {
+			t.Errorf("%s: got %d, want %d", v.msg, res, v.want)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		msg       string
+		chunkSize int
+		keys      []int
+	}{
+		{"one chunk", 100, []int{5, 3, 10, 1}},
+		{"many chunks", 3, perm(50)},
+		{"duplicate keys", 4, []int{7, 100, 7, 3, 100, 7, 20, 3, 7, 1}},
+		{"chunk per row", 1, []int{3, 2, 1, 2, 3}},
+		{"empty", 10, nil},
+	}
+
+	for _, v := range tests {
+		s, err := New(t.TempDir(), 1, v.chunkSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, k := range v.keys {
+			row := []string{strconv.Itoa(i), strconv.Itoa(k)}
+			if err = s.Add(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r, err := s.Sort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var res []int
+		seen := make(map[string]bool)
+		for {
+			row, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen[row[0]] {
+				t.Errorf("%s: row %s is read twice", v.msg, row[0])
+			}
+			seen[row[0]] = true
+			k, _ := strconv.Atoi(row[1])
+			res = append(res, k)
+		}
+		r.Close()
+		s.Close()
+
+		want := slices.Clone(v.keys)
+		slices.Sort(want)
+		if !slices.Equal(res, want) {
+			t.Errorf("%s: got %v, want %v", v.msg, res, want)
+		}
+	}
+}
+
+func TestAddShortRow(t *testing.T) {
+	s, err := New(t.TempDir(), 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err = s.Add([]string{"1", "2"}); err == nil {
+		t.Error("no error for a row without key field")
+	}
+}
+
+func perm(n int) []int {
+	res := make([]int, n)
+	for i, v := range rand.Perm(n) {
+		res[i] = v * 7
+	}
+	return res
+}
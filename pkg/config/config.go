@@ -3,13 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
-)
-
-var (
-	curatedAry = []int{1, 2, 3, 5, 6, 9, 105, 132, 151, 155,
-		163, 165, 167, 172, 173, 174, 175, 176, 177, 181, 183, 184, 185,
-		187, 188, 189, 193, 195, 197, 201, 203, 204, 205, 208, 209}
-	autoCuratedAry = []int{11, 12, 158, 170, 179, 186, 194, 196, 206, 207}
+	"time"
 )
 
 // Config is a struct that holds configuration parameters for the package.
@@ -53,15 +47,160 @@ type Config struct {
 	// PgDB is a database name for PostgreSQL.
 	PgDB string
 
-	// Curated is a list of data-sources IDs we consider to be curated by humans.
-	Curated []int
+	// KVStore is the type of key-value stores used by the build. It can be
+	// "badger" (default), "bbolt" or "memory". The memory store keeps all
+	// data in RAM and is suitable only for small builds and tests.
+	KVStore string
+
+	// FreshKV is true when key-value stores have to be created again even
+	// if they match the dump. By default stores created by a previous
+	// rebuild are reused when they were made from the same dump files.
+	FreshKV bool
+
+	// SortJoin is true when rebuild creates indices by a sort-merge join
+	// instead of lookups in key-value stores. Name-strings and their indices
+	// are sorted by legacy IDs of name-strings using temporary files in
+	// InputDir, and then joined in one pass. Vernacular strings are
+	// processed the same way.
+	SortJoin bool
 
-	// AutoCurated is a list of data-sources IDs we consider to be curated by
-	// machines.
-	AutoCurated []int
+	// SortChunkSize is the number of rows sorted in memory by the sort-merge
+	// join. Larger chunks use more memory and fewer temporary files.
+	SortChunkSize int
+
+	// Pipelines set the number of workers and database writers of rebuild
+	// stages that import CSV files.
+	Pipelines Pipelines
 
 	// BatchSize is a number of records to be saved in one transaction.
 	BatchSize int
+
+	// Compression is the method of compression of CSV dump files. It can be
+	// empty (no compression), "gzip" or "zstd". The builder detects the
+	// compression of the files by their extension.
+	Compression string
+
+	// DumpChunkSize is the approximate number of rows in one chunk of a large
+	// table. Chunks are read in parallel by JobsNum connections if
+	// DumpLockTables is true, and by one connection otherwise.
+	DumpChunkSize int
+
+	// DumpLockTables is true when the dump briefly locks GNI database with
+	// FLUSH TABLES WITH READ LOCK to start identical snapshots on JobsNum
+	// connections. The lock blocks all writers of the database until the
+	// snapshots start, and requires RELOAD privilege. Without it the dump
+	// reads all tables using one snapshot connection.
+	DumpLockTables bool
+
+	// DumpResume is true when a dump continues the previous unfinished dump.
+	// Finished tables and chunks are not downloaded again.
+	DumpResume bool
+
+	// DumpMixedSnapshots is true when a resumed dump may combine files from
+	// snapshots of different runs. A resumed dump cannot continue the
+	// snapshot of the interrupted run, so without this option resume is
+	// refused.
+	DumpMixedSnapshots bool
+
+	// DumpSince limits a dump to data-sources harvested on or after this
+	// date. Such incremental dump contains indices of selected data-sources
+	// and name-strings they use.
+	DumpSince time.Time
+
+	// DumpSources is a list of IDs of data-sources for an incremental dump.
+	// It is combined with data-sources selected by DumpSince.
+	DumpSources []int
+
+	// SyncDates is true when dump writes the date of the latest harvest
+	// of each data-source to data_sources.updated_at of GNI database.
+	// By default the dump does not modify GNI database.
+	SyncDates bool
+
+	// Steps is a list of rebuild stages to run. If empty, all stages are
+	// selected.
+	Steps []string
+
+	// FromStep is the first rebuild stage to run. Stages before it are
+	// ignored.
+	FromStep string
+
+	// ToStep is the last rebuild stage to run. Stages after it are ignored.
+	ToStep string
+
+	// Force is true when create resets the database without confirmation.
+	// It is required when create runs without a terminal.
+	Force bool
+
+	// Backup is true when create saves existing tables to compressed files
+	// in InputDir before the reset.
+	Backup bool
+
+	// Staging is true when create and rebuild work with the staging schema
+	// instead of the public one. The staging schema becomes public after
+	// the swap.
+	Staging bool
+
+	// DryRun is true when reparse only reports changes of parsing results
+	// without saving them to the database.
+	DryRun bool
+
+	// ReparseReport is the path of the file with changes found by reparse.
+	// The report is in CSV format if the file has ".csv" extension, and in
+	// JSON lines format otherwise. If empty, the report is saved to
+	// InputDir.
+	ReparseReport string
+
+	// ReparseOlderThan limits reparse to name-strings parsed by gnparser
+	// versions older than the given one (for example "v1.11.0"), or with an
+	// unknown version of the parser.
+	ReparseOlderThan string
+
+	// ParseQualities limits reparse to name-strings with the given parse
+	// quality.
+	ParseQualities []int
+
+	// Sources is a list of IDs of data-sources for per-source rebuild. Data
+	// of these data-sources is replaced, data of other data-sources stays
+	// intact. If empty, the whole database is rebuilt. For reparse it limits
+	// name-strings to ones that belong to the data-sources.
+	Sources []int
+
+	// OutlinkSampleSize is the number of records per data-source sampled
+	// by the outlinks check.
+	OutlinkSampleSize int
+
+	// Restart is true when a rebuild should ignore stages recorded as
+	// completed by a previous unfinished rebuild.
+	Restart bool
+}
+
+// Pipelines set concurrency of rebuild stages that import CSV files.
+type Pipelines struct {
+	// NameStrings is the import of name-strings and canonical forms.
+	NameStrings Pipeline
+
+	// NameIndices is the import of name-string indices.
+	NameIndices Pipeline
+
+	// VernStrings is the import of vernacular strings.
+	VernStrings Pipeline
+
+	// VernIndices is the import of vernacular string indices.
+	VernIndices Pipeline
+}
+
+// Pipeline sets concurrency of one import. Rows of a CSV file are
+// converted by Workers goroutines and saved to the database by Writers
+// goroutines.
+type Pipeline struct {
+	// Workers is the number of goroutines that convert rows. If it is not
+	// set, JobsNum is used.
+	Workers int
+
+	// Writers is the number of goroutines that save data to the database
+	// with COPY. Each writer uses its own connection. If it is not set,
+	// there is one writer.
+	Writers int
 }
 
 // Option type allows to change settings for Config.
@@ -137,6 +276,192 @@ func OptPgDB(d string) Option {
 	}
 }
 
+// OptKVStore sets the type of key-value stores.
+func OptKVStore(s string) Option {
+	return func(cfg *Config) {
+		cfg.KVStore = s
+	}
+}
+
+// OptFreshKV forces recreation of key-value stores.
+func OptFreshKV(b bool) Option {
+	return func(cfg *Config) {
+		cfg.FreshKV = b
+	}
+}
+
+// OptSortJoin sets creation of indices by the sort-merge join.
+func OptSortJoin(b bool) Option {
+	return func(cfg *Config) {
+		cfg.SortJoin = b
+	}
+}
+
+// OptSortChunkSize sets the number of rows sorted in memory.
+func OptSortChunkSize(i int) Option {
+	return func(cfg *Config) {
+		cfg.SortChunkSize = i
+	}
+}
+
+// OptPipelines sets concurrency of imports of CSV files.
+func OptPipelines(p Pipelines) Option {
+	return func(cfg *Config) {
+		cfg.Pipelines = p
+	}
+}
+
+// OptCompression sets compression method for CSV dump files.
+func OptCompression(c string) Option {
+	return func(cfg *Config) {
+		cfg.Compression = c
+	}
+}
+
+// OptDumpChunkSize sets the number of rows in one chunk of a dumped table.
+func OptDumpChunkSize(i int) Option {
+	return func(cfg *Config) {
+		cfg.DumpChunkSize = i
+	}
+}
+
+// OptDumpLockTables allows dump to lock GNI database while parallel
+// snapshots start.
+func OptDumpLockTables(b bool) Option {
+	return func(cfg *Config) {
+		cfg.DumpLockTables = b
+	}
+}
+
+// OptDumpResume sets dump to continue the previous unfinished dump.
+func OptDumpResume(b bool) Option {
+	return func(cfg *Config) {
+		cfg.DumpResume = b
+	}
+}
+
+// OptDumpMixedSnapshots allows a resumed dump to combine data from
+// snapshots of different runs.
+func OptDumpMixedSnapshots(b bool) Option {
+	return func(cfg *Config) {
+		cfg.DumpMixedSnapshots = b
+	}
+}
+
+// OptDumpSince limits dump to data-sources harvested since the given date.
+func OptDumpSince(t time.Time) Option {
+	return func(cfg *Config) {
+		cfg.DumpSince = t
+	}
+}
+
+// OptDumpSources limits dump to the given data-sources.
+func OptDumpSources(ids []int) Option {
+	return func(cfg *Config) {
+		cfg.DumpSources = ids
+	}
+}
+
+// OptSyncDates allows dump to update data_sources dates in GNI database.
+func OptSyncDates(b bool) Option {
+	return func(cfg *Config) {
+		cfg.SyncDates = b
+	}
+}
+
+// OptSteps sets the list of rebuild stages to run.
+func OptSteps(s []string) Option {
+	return func(cfg *Config) {
+		cfg.Steps = s
+	}
+}
+
+// OptFromStep sets the first rebuild stage to run.
+func OptFromStep(s string) Option {
+	return func(cfg *Config) {
+		cfg.FromStep = s
+	}
+}
+
+// OptToStep sets the last rebuild stage to run.
+func OptToStep(s string) Option {
+	return func(cfg *Config) {
+		cfg.ToStep = s
+	}
+}
+
+// OptRestart sets rebuild to ignore the checkpoint of a previous run.
+func OptRestart(b bool) Option {
+	return func(cfg *Config) {
+		cfg.Restart = b
+	}
+}
+
+// OptSources limits rebuild to the given data-sources.
+func OptSources(ids []int) Option {
+	return func(cfg *Config) {
+		cfg.Sources = ids
+	}
+}
+
+// OptOutlinkSampleSize sets the number of records per data-source checked
+// by the outlinks check.
+func OptOutlinkSampleSize(i int) Option {
+	return func(cfg *Config) {
+		cfg.OutlinkSampleSize = i
+	}
+}
+
+// OptStaging sets create and rebuild to work with the staging schema.
+func OptStaging(b bool) Option {
+	return func(cfg *Config) {
+		cfg.Staging = b
+	}
+}
+
+// OptForce allows create to reset the database without confirmation.
+func OptForce(b bool) Option {
+	return func(cfg *Config) {
+		cfg.Force = b
+	}
+}
+
+// OptBackup sets create to save existing tables before the reset.
+func OptBackup(b bool) Option {
+	return func(cfg *Config) {
+		cfg.Backup = b
+	}
+}
+
+// OptDryRun sets reparse to report changes without saving them.
+func OptDryRun(b bool) Option {
+	return func(cfg *Config) {
+		cfg.DryRun = b
+	}
+}
+
+// OptReparseReport sets the path of the reparse report.
+func OptReparseReport(s string) Option {
+	return func(cfg *Config) {
+		cfg.ReparseReport = s
+	}
+}
+
+// OptReparseOlderThan limits reparse to names parsed by older versions of
+// gnparser.
+func OptReparseOlderThan(s string) Option {
+	return func(cfg *Config) {
+		cfg.ReparseOlderThan = s
+	}
+}
+
+// OptParseQualities limits reparse to names with the given parse quality.
+func OptParseQualities(qs []int) Option {
+	return func(cfg *Config) {
+		cfg.ParseQualities = qs
+	}
+}
+
 func New(opts ...Option) Config {
 	inpDir, err := os.UserCacheDir()
 	if err != nil {
@@ -145,24 +470,40 @@ func New(opts ...Option) Config {
 	inpDir = filepath.Join(inpDir, "gnidump")
 
 	res := Config{
-		InputDir:    inpDir,
-		DumpDir:     filepath.Join(inpDir, "gni-dump"),
-		SciKVDir:    filepath.Join(inpDir, "sci"),
-		VernKVDir:   filepath.Join(inpDir, "vern"),
-		JobsNum:     4,
-		MyDB:        "gni",
-		PgHost:      "0.0.0.0",
-		PgUser:      "postgres",
-		PgPass:      "postgres",
-		PgDB:        "gnames",
-		Curated:     curatedAry,
-		AutoCurated: autoCuratedAry,
-		BatchSize:   50_000,
+		InputDir:  inpDir,
+		DumpDir:   filepath.Join(inpDir, "gni-dump"),
+		SciKVDir:  filepath.Join(inpDir, "sci"),
+		VernKVDir: filepath.Join(inpDir, "vern"),
+		JobsNum:   4,
+		MyDB:      "gni",
+		PgHost:    "0.0.0.0",
+		PgUser:    "postgres",
+		PgPass:    "postgres",
+		PgDB:      "gnames",
+		KVStore:   "badger",
+		BatchSize: 50_000,
+
+		SortChunkSize: 1_000_000,
+
+		DumpChunkSize:     5_000_000,
+		OutlinkSampleSize: 100,
 	}
 
 	for _, opt := range opts {
 		opt(&res)
 	}
 
+	pl := &res.Pipelines
+	for _, v := range []*Pipeline{
+		&pl.NameStrings, &pl.NameIndices, &pl.VernStrings, &pl.VernIndices,
+	} {
+		if v.Workers < 1 {
+			v.Workers = max(res.JobsNum, 1)
+		}
+		if v.Writers < 1 {
+			v.Writers = 1
+		}
+	}
+
 	return res
 }
@@ -133,6 +133,10 @@ type NameString struct {
 	// ParseQuality is numeric representation of the quality of parsing.
 	// 0 - no parse, 1 - clear parse, 2 - some problems, 3 - big problems.
 	ParseQuality int `gorm:"type:int;not null;default:0"`
+
+	// ParserVersion is the version of gnparser that produced canonical
+	// forms, flags and parse quality of the name-string.
+	ParserVersion string `gorm:"type:varchar(50)"`
 }
 
 // Canonical is a 'simple' canonical form.
@@ -208,8 +212,8 @@ type NameStringIndex struct {
 	// The rank of the name.
 	Rank string `gorm:"type:varchar(255)"`
 
-	// TaxonomicStatus provides information if name is accepted, bare name,
-	// synonym etc.
+	// TaxonomicStatus provides information if name is accepted or synonym.
+	// It uses string values of gnlib verifier.TaxonomicStatus.
 	TaxonomicStatus string `gorm:"type:varchar(255)"`
 
 	// RecordID of a currently accepted name-string for the taxon.
@@ -296,6 +300,24 @@ type VernacularStringIndex struct {
 	CountryCode string `gorm:"type:varchar(50)"`
 }
 
+// BuildMetadata keeps information about the build of the database, for
+// example the version of gnparser used to parse name-strings.
+type BuildMetadata struct {
+	// Key is the name of a property.
+	Key string `gorm:"type:varchar(50);primary_key;auto_increment:false"`
+
+	// Value is the value of the property.
+	Value string `gorm:"type:varchar(255)"`
+
+	// UpdatedAt is the time when the property was saved.
+	UpdatedAt time.Time `gorm:"type:timestamp without time zone"`
+}
+
+// TableName sets the name of the table for BuildMetadata.
+func (BuildMetadata) TableName() string {
+	return "build_metadata"
+}
+
 func SetCollation(db *pgxpool.Pool) error {
 	ctx := context.Background()
 	type d struct {
@@ -1,6 +1,8 @@
 package gnidump
 
 import (
+	"context"
+
 	"github.com/gnames/gnidump/internal/ent/build"
 	"github.com/gnames/gnidump/internal/ent/dump"
 	"github.com/gnames/gnidump/pkg/config"
@@ -26,6 +28,21 @@ func (g *gnidump) Dump(d dump.Dumper) error {
 }
 
 // Build builds GNI database from CSV files to PostgreSQL.
-func (g *gnidump) Build(b build.Builder) error {
-	return b.Build()
+func (g *gnidump) Build(ctx context.Context, b build.Builder) error {
+	return b.Build(ctx)
+}
+
+// Reparse updates parsing results of name-strings in PostgreSQL.
+func (g *gnidump) Reparse(b build.Builder) error {
+	return b.Reparse()
+}
+
+// UpdateOutlinks recomputes outlinks of data-sources in PostgreSQL.
+func (g *gnidump) UpdateOutlinks(b build.Builder) error {
+	return b.UpdateOutlinks()
+}
+
+// CheckOutlinks validates outlinks of data-sources in PostgreSQL.
+func (g *gnidump) CheckOutlinks(b build.Builder) error {
+	return b.CheckOutlinks()
 }
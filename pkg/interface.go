@@ -1,6 +1,8 @@
 package gnidump
 
 import (
+	"context"
+
 	"github.com/gnames/gnidump/internal/ent/build"
 	"github.com/gnames/gnidump/internal/ent/dump"
 )
@@ -11,5 +13,14 @@ type GNIdump interface {
 	Dump(dump.Dumper) error
 
 	// Build builds GNI database from CSV files to PostgreSQL.
-	Build(build.Builder) error
+	Build(context.Context, build.Builder) error
+
+	// Reparse updates parsing results of name-strings in PostgreSQL.
+	Reparse(build.Builder) error
+
+	// UpdateOutlinks recomputes outlinks of data-sources in PostgreSQL.
+	UpdateOutlinks(build.Builder) error
+
+	// CheckOutlinks validates outlinks of data-sources in PostgreSQL.
+	CheckOutlinks(build.Builder) error
 }
@@ -28,6 +28,7 @@ func (m *modelio) Migrate() error {
 		&model.WordNameString{},
 		&model.VernacularString{},
 		&model.VernacularStringIndex{},
+		&model.BuildMetadata{},
 	)
 	if m.db.Error != nil {
 		return m.db.Error